@@ -0,0 +1,466 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+)
+
+var _ Client = (*Breaker)(nil)
+var _ Heartbeater = (*Breaker)(nil)
+
+// ErrCircuitOpen is returned by the circuit breaker when
+// the circuit is open and requests are not permitted.
+var ErrCircuitOpen = errors.New("Circuit Breaker Open")
+
+// default circuit breaker configuration.
+const (
+	defaultBreakerThreshold   = 5
+	defaultBreakerCooldown    = 30 * time.Second
+	defaultBreakerRetryBudget = time.Minute
+)
+
+// BreakerState represents the state of a circuit breaker.
+type BreakerState int
+
+// Circuit breaker states.
+const (
+	// StateClosed permits all requests.
+	StateClosed BreakerState = iota
+
+	// StateOpen rejects all requests until the cooldown
+	// period has elapsed.
+	StateOpen
+
+	// StateHalfOpen permits a single trial request. The
+	// circuit is closed if the trial request succeeds, and
+	// re-opened if the trial request fails.
+	StateHalfOpen
+)
+
+// String returns the string representation of the state.
+func (s BreakerState) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker wraps a Client with a circuit breaker that is
+// shared across all calls. The circuit opens after a number
+// of consecutive failed calls, and rejects calls until the
+// cooldown period has elapsed, to prevent runners from
+// overwhelming a server that is down.
+type Breaker struct {
+	Client
+
+	// Threshold is the number of consecutive failures that
+	// opens the circuit.
+	Threshold int
+
+	// Cooldown is the amount of time the circuit remains
+	// open before a trial request is permitted.
+	Cooldown time.Duration
+
+	// RetryBudget bounds the time spent retrying a call.
+	RetryBudget time.Duration
+
+	// Machine is the machine name sent with the ping that
+	// is used as the trial request before a long-polling
+	// request is permitted.
+	Machine string
+
+	// IsFailure returns true if the error indicates the
+	// server is unavailable. If nil, transport errors and
+	// exhausted retry budgets are considered failures.
+	IsFailure func(error) bool
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	opened   time.Time
+	trial    bool
+	changed  chan struct{}
+}
+
+// NewBreaker returns a Client that wraps the client with a
+// circuit breaker.
+func NewBreaker(client Client) *Breaker {
+	return &Breaker{
+		Client:      client,
+		Threshold:   defaultBreakerThreshold,
+		Cooldown:    defaultBreakerCooldown,
+		RetryBudget: defaultBreakerRetryBudget,
+	}
+}
+
+// State returns the current state of the circuit.
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.current()
+}
+
+// Check returns the state of the circuit, and an error if
+// the circuit is open. It can be used as a health check.
+func (b *Breaker) Check() (string, error) {
+	state := b.State()
+	if state == StateOpen {
+		return state.String(), ErrCircuitOpen
+	}
+	return state.String(), nil
+}
+
+// Wait blocks until the circuit permits requests or the
+// context is canceled.
+func (b *Breaker) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		state := b.current()
+		if state == StateClosed || (state == StateHalfOpen && !b.trial) {
+			b.mu.Unlock()
+			return nil
+		}
+		changed := b.notify()
+		timeout := time.Until(b.opened.Add(b.cooldown()))
+		b.mu.Unlock()
+
+		var expired <-chan time.Time
+		var timer *time.Timer
+		if state == StateOpen {
+			timer = time.NewTimer(timeout)
+			expired = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		case <-expired:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// Join notifies the server the runner is joining the cluster.
+func (b *Breaker) Join(ctx context.Context, machine string) error {
+	ctx, trial, err := b.allow(ctx)
+	if err != nil {
+		return err
+	}
+	err = b.Client.Join(ctx, machine)
+	b.done(trial, err)
+	return err
+}
+
+// Leave notifies the server the runner is leaving the cluster.
+func (b *Breaker) Leave(ctx context.Context, machine string) error {
+	ctx, trial, err := b.allow(ctx)
+	if err != nil {
+		return err
+	}
+	err = b.Client.Leave(ctx, machine)
+	b.done(trial, err)
+	return err
+}
+
+// Ping sends a ping message to the server to test connectivity.
+func (b *Breaker) Ping(ctx context.Context, machine string) error {
+	ctx, trial, err := b.allow(ctx)
+	if err != nil {
+		return err
+	}
+	err = b.Client.Ping(ctx, machine)
+	b.done(trial, err)
+	return err
+}
+
+// Heartbeat reports the runner status to the server. If the
+// client cannot report the runner status, a ping message is
+// sent instead.
+func (b *Breaker) Heartbeat(ctx context.Context, node *Node) error {
+	ctx, trial, err := b.allow(ctx)
+	if err != nil {
+		return err
+	}
+	if c, ok := b.Client.(Heartbeater); ok {
+		err = c.Heartbeat(ctx, node)
+	} else {
+		err = b.Client.Ping(ctx, node.Machine)
+	}
+	b.done(trial, err)
+	return err
+}
+
+// Request requests the next available build stage for execution.
+func (b *Breaker) Request(ctx context.Context, args *Filter) (*drone.Stage, error) {
+	ctx, err := b.allowPoll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stage, err := b.Client.Request(ctx, args)
+	b.done(false, err)
+	return stage, err
+}
+
+// Accept accepts the build stage for execution.
+func (b *Breaker) Accept(ctx context.Context, stage *drone.Stage) error {
+	ctx, trial, err := b.allow(ctx)
+	if err != nil {
+		return err
+	}
+	err = b.Client.Accept(ctx, stage)
+	b.done(trial, err)
+	return err
+}
+
+// Detail gets the build stage details for execution.
+func (b *Breaker) Detail(ctx context.Context, stage *drone.Stage) (*Context, error) {
+	ctx, trial, err := b.allow(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out, err := b.Client.Detail(ctx, stage)
+	b.done(trial, err)
+	return out, err
+}
+
+// Update updates the build stage.
+func (b *Breaker) Update(ctx context.Context, stage *drone.Stage) error {
+	ctx, trial, err := b.allow(ctx)
+	if err != nil {
+		return err
+	}
+	err = b.Client.Update(ctx, stage)
+	b.done(trial, err)
+	return err
+}
+
+// UpdateStep updates the build step.
+func (b *Breaker) UpdateStep(ctx context.Context, step *drone.Step) error {
+	ctx, trial, err := b.allow(ctx)
+	if err != nil {
+		return err
+	}
+	err = b.Client.UpdateStep(ctx, step)
+	b.done(trial, err)
+	return err
+}
+
+// Watch watches for build cancellation requests.
+func (b *Breaker) Watch(ctx context.Context, build int64) (bool, error) {
+	ctx, err := b.allowPoll(ctx)
+	if err != nil {
+		return false, err
+	}
+	done, err := b.Client.Watch(ctx, build)
+	b.done(false, err)
+	return done, err
+}
+
+// Batch batch writes logs to the build logs.
+func (b *Breaker) Batch(ctx context.Context, step int64, lines []*drone.Line) error {
+	ctx, trial, err := b.allow(ctx)
+	if err != nil {
+		return err
+	}
+	err = b.Client.Batch(ctx, step, lines)
+	b.done(trial, err)
+	return err
+}
+
+// Upload uploads the full logs to the server.
+func (b *Breaker) Upload(ctx context.Context, step int64, lines []*drone.Line) error {
+	ctx, trial, err := b.allow(ctx)
+	if err != nil {
+		return err
+	}
+	err = b.Client.Upload(ctx, step, lines)
+	b.done(trial, err)
+	return err
+}
+
+// UploadCard uploads a card to drone server.
+func (b *Breaker) UploadCard(ctx context.Context, step int64, card *drone.CardInput) error {
+	ctx, trial, err := b.allow(ctx)
+	if err != nil {
+		return err
+	}
+	err = b.Client.UploadCard(ctx, step, card)
+	b.done(trial, err)
+	return err
+}
+
+// allow returns an error if the circuit does not permit
+// the request, and true if the request is a trial request.
+// The returned context bounds the time spent retrying the
+// request.
+func (b *Breaker) allow(ctx context.Context) (context.Context, bool, error) {
+	b.mu.Lock()
+	var trial bool
+	switch b.current() {
+	case StateOpen:
+		b.mu.Unlock()
+		return ctx, false, ErrCircuitOpen
+	case StateHalfOpen:
+		if b.trial {
+			b.mu.Unlock()
+			return ctx, false, ErrCircuitOpen
+		}
+		b.trial = true
+		trial = true
+	}
+	b.mu.Unlock()
+	return withRetryBudget(ctx, b.retryBudget()), trial, nil
+}
+
+// allowPoll returns an error if the circuit does not permit
+// the long-polling request. A long-polling request may block
+// for a long time, and would prevent other requests while
+// holding the trial slot. Instead, a ping is sent as the
+// trial request before the long-polling request is permitted.
+func (b *Breaker) allowPoll(ctx context.Context) (context.Context, error) {
+	ctx, trial, err := b.allow(ctx)
+	if err != nil || !trial {
+		return ctx, err
+	}
+	err = b.Client.Ping(ctx, b.Machine)
+	b.done(true, err)
+	if isCanceled(err) || (err != nil && b.isFailure(err)) {
+		return ctx, err
+	}
+	return ctx, nil
+}
+
+// done records the result of a permitted request and
+// updates the state of the circuit.
+func (b *Breaker) done(trial bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := b.current()
+	if trial {
+		b.trial = false
+	}
+	// requests canceled by the caller do not indicate
+	// whether or not the server is available.
+	if isCanceled(err) {
+		if trial {
+			// notify waiting callers that a trial
+			// request is permitted.
+			b.transition(state)
+		}
+		return
+	}
+	if !b.isFailure(err) {
+		b.failures = 0
+		if state != StateClosed {
+			b.transition(StateClosed)
+		}
+		return
+	}
+	b.failures++
+	if state == StateHalfOpen || b.failures >= b.threshold() {
+		b.opened = time.Now()
+		b.transition(StateOpen)
+	}
+}
+
+// current returns the current state, transitioning an open
+// circuit to half-open once the cooldown has elapsed. The
+// caller must hold the lock.
+func (b *Breaker) current() BreakerState {
+	if b.state == StateOpen && time.Since(b.opened) >= b.cooldown() {
+		b.transition(StateHalfOpen)
+	}
+	return b.state
+}
+
+// transition transitions the circuit to the state and
+// notifies waiting callers. The caller must hold the lock.
+func (b *Breaker) transition(state BreakerState) {
+	b.state = state
+	if b.changed != nil {
+		close(b.changed)
+		b.changed = nil
+	}
+}
+
+// notify returns a channel that is closed on the next state
+// transition. The caller must hold the lock.
+func (b *Breaker) notify() <-chan struct{} {
+	if b.changed == nil {
+		b.changed = make(chan struct{})
+	}
+	return b.changed
+}
+
+func (b *Breaker) isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if b.IsFailure != nil {
+		return b.IsFailure(err)
+	}
+	return IsUnavailable(err)
+}
+
+func (b *Breaker) threshold() int {
+	if b.Threshold <= 0 {
+		return defaultBreakerThreshold
+	}
+	return b.Threshold
+}
+
+func (b *Breaker) retryBudget() time.Duration {
+	if b.RetryBudget <= 0 {
+		return defaultBreakerRetryBudget
+	}
+	return b.RetryBudget
+}
+
+func (b *Breaker) cooldown() time.Duration {
+	if b.Cooldown <= 0 {
+		return defaultBreakerCooldown
+	}
+	return b.Cooldown
+}
+
+// IsUnavailable returns true if the error indicates the
+// server is unavailable, including transport errors and
+// exhausted retry budgets.
+func IsUnavailable(err error) bool {
+	if isCanceled(err) {
+		return false
+	}
+	switch err.(type) {
+	case *RetryError, *url.Error, net.Error:
+		return true
+	}
+	return false
+}
+
+// helper function returns true if the error indicates the
+// request was canceled by the caller.
+func isCanceled(err error) bool {
+	if v, ok := err.(*url.Error); ok {
+		err = v.Err
+	}
+	return err == context.Canceled ||
+		err == context.DeadlineExceeded
+}
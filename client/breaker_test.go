@@ -0,0 +1,207 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+)
+
+func TestBreaker(t *testing.T) {
+	mock := &mockPingClient{err: &url.Error{Op: "Post", Err: errors.New("connection refused")}}
+	breaker := NewBreaker(mock)
+	breaker.Threshold = 2
+	breaker.Cooldown = 50 * time.Millisecond
+
+	breaker.Ping(noContext, "")
+	if got, want := breaker.State(), StateClosed; got != want {
+		t.Errorf("Want state %s, got %s", want, got)
+	}
+	breaker.Ping(noContext, "")
+	if got, want := breaker.State(), StateOpen; got != want {
+		t.Errorf("Want state %s, got %s", want, got)
+	}
+	if err := breaker.Ping(noContext, ""); err != ErrCircuitOpen {
+		t.Errorf("Want circuit open error, got %v", err)
+	}
+	if got, want := mock.count, 2; got != want {
+		t.Errorf("Want %d calls while open, got %d", want, got)
+	}
+
+	// after the cooldown the circuit is half-open, and a
+	// failed trial request re-opens the circuit.
+	time.Sleep(breaker.Cooldown)
+	if got, want := breaker.State(), StateHalfOpen; got != want {
+		t.Errorf("Want state %s, got %s", want, got)
+	}
+	breaker.Ping(noContext, "")
+	if got, want := breaker.State(), StateOpen; got != want {
+		t.Errorf("Want state %s, got %s", want, got)
+	}
+
+	// after the cooldown a successful trial request closes
+	// the circuit.
+	time.Sleep(breaker.Cooldown)
+	mock.err = nil
+	if err := breaker.Ping(noContext, ""); err != nil {
+		t.Error(err)
+	}
+	if got, want := breaker.State(), StateClosed; got != want {
+		t.Errorf("Want state %s, got %s", want, got)
+	}
+}
+
+func TestBreaker_IgnoreErrors(t *testing.T) {
+	mock := &mockPingClient{}
+	breaker := NewBreaker(mock)
+	breaker.Threshold = 1
+
+	mock.err = errors.New("Not Found")
+	breaker.Ping(noContext, "")
+	mock.err = context.Canceled
+	breaker.Ping(noContext, "")
+	mock.err = &url.Error{Op: "Post", Err: context.DeadlineExceeded}
+	breaker.Ping(noContext, "")
+	if got, want := breaker.State(), StateClosed; got != want {
+		t.Errorf("Want state %s, got %s", want, got)
+	}
+
+	mock.err = &RetryError{Attempts: 1}
+	breaker.Ping(noContext, "")
+	if got, want := breaker.State(), StateOpen; got != want {
+		t.Errorf("Want state %s, got %s", want, got)
+	}
+}
+
+func TestBreakerCheck(t *testing.T) {
+	breaker := NewBreaker(&mockPingClient{err: &RetryError{}})
+	breaker.Threshold = 1
+	if status, err := breaker.Check(); status != "closed" || err != nil {
+		t.Errorf("Want closed circuit healthy, got %s %v", status, err)
+	}
+	breaker.Ping(noContext, "")
+	if status, err := breaker.Check(); status != "open" || err != ErrCircuitOpen {
+		t.Errorf("Want open circuit unhealthy, got %s %v", status, err)
+	}
+}
+
+func TestBreakerWait(t *testing.T) {
+	breaker := NewBreaker(&mockPingClient{err: &RetryError{}})
+	breaker.Threshold = 1
+	breaker.Cooldown = 50 * time.Millisecond
+	breaker.Ping(noContext, "")
+
+	start := time.Now()
+	if err := breaker.Wait(noContext); err != nil {
+		t.Error(err)
+	}
+	if elapsed := time.Since(start); elapsed < 25*time.Millisecond {
+		t.Errorf("Expect wait to block while the circuit is open")
+	}
+	if got, want := breaker.State(), StateHalfOpen; got != want {
+		t.Errorf("Want state %s, got %s", want, got)
+	}
+}
+
+func TestBreakerWait_Canceled(t *testing.T) {
+	breaker := NewBreaker(&mockPingClient{err: &RetryError{}})
+	breaker.Threshold = 1
+	breaker.Cooldown = time.Hour
+	breaker.Ping(noContext, "")
+
+	ctx, cancel := context.WithTimeout(noContext, 10*time.Millisecond)
+	defer cancel()
+	if err := breaker.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Want deadline exceeded error, got %v", err)
+	}
+}
+
+// this test verifies that the circuit opens when the server
+// is unavailable and the client uses the default retry
+// policy, which retries until the context is canceled.
+func TestBreaker_RetryBudget(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(503)
+	}))
+	defer ts.Close()
+
+	breaker := NewBreaker(New(ts.URL, "", false))
+	breaker.Threshold = 1
+	breaker.RetryBudget = 50 * time.Millisecond
+
+	err := breaker.Upload(noContext, 1, nil)
+	if _, ok := err.(*RetryError); !ok {
+		t.Errorf("Want retry error, got %v", err)
+	}
+	if got, want := breaker.State(), StateOpen; got != want {
+		t.Errorf("Want state %s, got %s", want, got)
+	}
+}
+
+// this test verifies that a long-polling request does not
+// hold the trial slot while the circuit is half-open, and
+// that a ping is sent as the trial request instead.
+func TestBreaker_LongPoll(t *testing.T) {
+	mock := &mockPollClient{polling: make(chan struct{})}
+	mock.err = &RetryError{}
+	breaker := NewBreaker(mock)
+	breaker.Threshold = 1
+	breaker.Cooldown = 10 * time.Millisecond
+	breaker.Ping(noContext, "")
+	time.Sleep(breaker.Cooldown)
+
+	mock.err = nil
+	ctx, cancel := context.WithCancel(noContext)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		breaker.Request(ctx, nil)
+		close(done)
+	}()
+	<-mock.polling
+
+	if got, want := breaker.State(), StateClosed; got != want {
+		t.Errorf("Want state %s, got %s", want, got)
+	}
+	if err := breaker.Ping(noContext, ""); err != nil {
+		t.Errorf("Want calls permitted during a long-polling request, got %v", err)
+	}
+	cancel()
+	<-done
+}
+
+// mock client that returns a static error from the ping
+// method.
+type mockPingClient struct {
+	Client
+
+	count int
+	err   error
+}
+
+func (m *mockPingClient) Ping(ctx context.Context, machine string) error {
+	m.count++
+	return m.err
+}
+
+// mock client that blocks in the request method until the
+// context is canceled.
+type mockPollClient struct {
+	mockPingClient
+	polling chan struct{}
+}
+
+func (m *mockPollClient) Request(ctx context.Context, args *Filter) (*drone.Stage, error) {
+	close(m.polling)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
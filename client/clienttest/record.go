@@ -0,0 +1,187 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package clienttest provides utilities for testing runners
+// without a Drone server, including a client that records
+// calls, a client that replays recorded calls, and a fake
+// server that implements the runner API.
+package clienttest
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+)
+
+var _ client.Client = (*Recorder)(nil)
+
+type (
+	// Call is a recorded client call.
+	Call struct {
+		Method string          `json:"method"`
+		Args   json.RawMessage `json:"args,omitempty"`
+		Result json.RawMessage `json:"result,omitempty"`
+		Error  string          `json:"error,omitempty"`
+	}
+
+	// logArgs provides the arguments to the log methods.
+	logArgs struct {
+		Step  int64            `json:"step"`
+		Lines []*drone.Line    `json:"lines,omitempty"`
+		Card  *drone.CardInput `json:"card,omitempty"`
+	}
+)
+
+// Recorder wraps a Client and records every call and
+// response, which can be saved to a file and replayed with
+// a Replayer.
+type Recorder struct {
+	client.Client
+
+	mu    sync.Mutex
+	calls []*Call
+}
+
+// NewRecorder returns a Client that records calls to the
+// client.
+func NewRecorder(client client.Client) *Recorder {
+	return &Recorder{Client: client}
+}
+
+// Calls returns the recorded calls.
+func (r *Recorder) Calls() []*Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]*Call, len(r.calls))
+	copy(out, r.calls)
+	return out
+}
+
+// Save writes the recorded calls to the file in json
+// format.
+func (r *Recorder) Save(path string) error {
+	data, err := json.MarshalIndent(r.Calls(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// Join notifies the server the runner is joining the cluster.
+func (r *Recorder) Join(ctx context.Context, machine string) error {
+	err := r.Client.Join(ctx, machine)
+	r.record("Join", machine, nil, err)
+	return err
+}
+
+// Leave notifies the server the runner is leaving the cluster.
+func (r *Recorder) Leave(ctx context.Context, machine string) error {
+	err := r.Client.Leave(ctx, machine)
+	r.record("Leave", machine, nil, err)
+	return err
+}
+
+// Ping sends a ping message to the server to test connectivity.
+func (r *Recorder) Ping(ctx context.Context, machine string) error {
+	err := r.Client.Ping(ctx, machine)
+	r.record("Ping", machine, nil, err)
+	return err
+}
+
+// Request requests the next available build stage for execution.
+func (r *Recorder) Request(ctx context.Context, args *client.Filter) (*drone.Stage, error) {
+	stage, err := r.Client.Request(ctx, args)
+	r.record("Request", args, stage, err)
+	return stage, err
+}
+
+// Accept accepts the build stage for execution.
+func (r *Recorder) Accept(ctx context.Context, stage *drone.Stage) error {
+	args := marshal(stage)
+	err := r.Client.Accept(ctx, stage)
+	r.record("Accept", args, stage, err)
+	return err
+}
+
+// Detail gets the build stage details for execution.
+func (r *Recorder) Detail(ctx context.Context, stage *drone.Stage) (*client.Context, error) {
+	out, err := r.Client.Detail(ctx, stage)
+	r.record("Detail", stage, out, err)
+	return out, err
+}
+
+// Update updates the build stage.
+func (r *Recorder) Update(ctx context.Context, stage *drone.Stage) error {
+	args := marshal(stage)
+	err := r.Client.Update(ctx, stage)
+	r.record("Update", args, stage, err)
+	return err
+}
+
+// UpdateStep updates the build step.
+func (r *Recorder) UpdateStep(ctx context.Context, step *drone.Step) error {
+	args := marshal(step)
+	err := r.Client.UpdateStep(ctx, step)
+	r.record("UpdateStep", args, step, err)
+	return err
+}
+
+// Watch watches for build cancellation requests.
+func (r *Recorder) Watch(ctx context.Context, build int64) (bool, error) {
+	done, err := r.Client.Watch(ctx, build)
+	r.record("Watch", build, done, err)
+	return done, err
+}
+
+// Batch batch writes logs to the build logs.
+func (r *Recorder) Batch(ctx context.Context, step int64, lines []*drone.Line) error {
+	err := r.Client.Batch(ctx, step, lines)
+	r.record("Batch", &logArgs{Step: step, Lines: lines}, nil, err)
+	return err
+}
+
+// Upload uploads the full logs to the server.
+func (r *Recorder) Upload(ctx context.Context, step int64, lines []*drone.Line) error {
+	err := r.Client.Upload(ctx, step, lines)
+	r.record("Upload", &logArgs{Step: step, Lines: lines}, nil, err)
+	return err
+}
+
+// UploadCard uploads a card to drone server.
+func (r *Recorder) UploadCard(ctx context.Context, step int64, card *drone.CardInput) error {
+	err := r.Client.UploadCard(ctx, step, card)
+	r.record("UploadCard", &logArgs{Step: step, Card: card}, nil, err)
+	return err
+}
+
+// record records the call. The arguments are recorded as
+// json. Arguments that are modified by the call should be
+// marshaled before the call is invoked.
+func (r *Recorder) record(method string, args, result interface{}, err error) {
+	call := &Call{Method: method}
+	if raw, ok := args.(json.RawMessage); ok {
+		call.Args = raw
+	} else if args != nil {
+		call.Args = marshal(args)
+	}
+	if result != nil {
+		call.Result = marshal(result)
+	}
+	if err != nil {
+		call.Error = err.Error()
+	}
+	r.mu.Lock()
+	r.calls = append(r.calls, call)
+	r.mu.Unlock()
+}
+
+// helper function returns the json encoded value.
+func marshal(v interface{}) json.RawMessage {
+	data, _ := json.Marshal(v)
+	return data
+}
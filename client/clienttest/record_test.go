@@ -0,0 +1,138 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package clienttest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	server := NewServer()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	server.Enqueue(&client.Context{
+		Build: &drone.Build{ID: 1},
+		Repo:  &drone.Repo{ID: 1},
+		Stage: &drone.Stage{Name: "default"},
+	})
+
+	recorder := NewRecorder(client.New(ts.URL, "", false))
+	want := playback(t, recorder)
+
+	path := filepath.Join(dir, "calls.json")
+	if err := recorder.Save(path); err != nil {
+		t.Error(err)
+		return
+	}
+
+	replayer, err := LoadReplayer(path)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	got := playback(t, replayer)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Want replayed results match recorded results")
+		t.Log(diff)
+	}
+	if n := replayer.Remaining(); n != 0 {
+		t.Errorf("Want all calls replayed, %d remaining", n)
+	}
+	if err := replayer.Ping(noContext, "localhost"); err == nil {
+		t.Errorf("Want error when no recorded calls remain")
+	}
+}
+
+func TestReplay_Error(t *testing.T) {
+	replayer := NewReplayer([]*Call{
+		{Method: "Accept", Error: client.ErrOptimisticLock.Error()},
+		{Method: "Update", Error: "Internal Server Error"},
+	})
+	if err := replayer.Accept(noContext, new(drone.Stage)); err != client.ErrOptimisticLock {
+		t.Errorf("Want optimistic lock error, got %v", err)
+	}
+	if err := replayer.Update(noContext, new(drone.Stage)); err == nil || err.Error() != "Internal Server Error" {
+		t.Errorf("Want recorded error, got %v", err)
+	}
+	// unrecorded batch calls are ignored because the
+	// number of calls is not deterministic.
+	if err := replayer.Batch(noContext, 1, nil); err != nil {
+		t.Errorf("Want unrecorded batch call ignored, got %v", err)
+	}
+}
+
+// this test verifies that Request blocks until the context
+// is canceled once all recorded requests are replayed, like
+// a long-poll request with no pending stages.
+func TestReplay_RequestBlocks(t *testing.T) {
+	replayer := NewReplayer([]*Call{
+		{Method: "Request", Result: []byte(`{"id":1}`)},
+	})
+	if _, err := replayer.Request(noContext, nil); err != nil {
+		t.Error(err)
+	}
+
+	ctx, cancel := context.WithTimeout(noContext, 50*time.Millisecond)
+	defer cancel()
+	stage, err := replayer.Request(ctx, nil)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Want request blocked until the deadline, got %v", err)
+	}
+	if stage != nil {
+		t.Errorf("Want nil stage, got %+v", stage)
+	}
+}
+
+// helper function executes a sequence of calls against the
+// client and returns the stage.
+func playback(t *testing.T, c client.Client) *drone.Stage {
+	stage, err := c.Request(noContext, &client.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stage.Machine = "localhost"
+	if err := c.Accept(noContext, stage); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Detail(noContext, stage); err != nil {
+		t.Fatal(err)
+	}
+	stage.Status = drone.StatusRunning
+	stage.Started = 1
+	stage.Steps = []*drone.Step{
+		{Number: 1, Name: "build", StageID: stage.ID, Status: drone.StatusPending},
+	}
+	if err := c.Update(noContext, stage); err != nil {
+		t.Fatal(err)
+	}
+	step := stage.Steps[0]
+	step.Status = drone.StatusPassing
+	if err := c.UpdateStep(noContext, step); err != nil {
+		t.Fatal(err)
+	}
+	lines := []*drone.Line{{Message: "hello world\n"}}
+	if err := c.Upload(noContext, step.ID, lines); err != nil {
+		t.Fatal(err)
+	}
+	return stage
+}
@@ -0,0 +1,203 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package clienttest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+)
+
+var _ client.Client = (*Replayer)(nil)
+
+// Replayer is a Client that replays recorded calls. Calls
+// are replayed in the order they were recorded, for each
+// method, regardless of the call arguments.
+type Replayer struct {
+	mu    sync.Mutex
+	calls map[string][]*Call
+}
+
+// NewReplayer returns a Client that replays the calls.
+func NewReplayer(calls []*Call) *Replayer {
+	r := &Replayer{calls: map[string][]*Call{}}
+	for _, call := range calls {
+		r.calls[call.Method] = append(r.calls[call.Method], call)
+	}
+	return r
+}
+
+// LoadReplayer returns a Client that replays the calls
+// recorded to the json file.
+func LoadReplayer(path string) (*Replayer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var calls []*Call
+	if err := json.Unmarshal(data, &calls); err != nil {
+		return nil, err
+	}
+	return NewReplayer(calls), nil
+}
+
+// Remaining returns the number of calls that have not been
+// replayed.
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int
+	for _, calls := range r.calls {
+		n += len(calls)
+	}
+	return n
+}
+
+// Join notifies the server the runner is joining the cluster.
+func (r *Replayer) Join(ctx context.Context, machine string) error {
+	return r.replay("Join", nil)
+}
+
+// Leave notifies the server the runner is leaving the cluster.
+func (r *Replayer) Leave(ctx context.Context, machine string) error {
+	return r.replay("Leave", nil)
+}
+
+// Ping sends a ping message to the server to test connectivity.
+func (r *Replayer) Ping(ctx context.Context, machine string) error {
+	return r.replay("Ping", nil)
+}
+
+// Request requests the next available build stage for
+// execution. If all recorded calls are replayed, Request
+// blocks until the context is canceled, like a long-poll
+// request with no pending stages.
+func (r *Replayer) Request(ctx context.Context, args *client.Filter) (*drone.Stage, error) {
+	call, ok := r.pop("Request")
+	if !ok {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	var stage *drone.Stage
+	err := decode(call, &stage)
+	return stage, err
+}
+
+// Accept accepts the build stage for execution.
+func (r *Replayer) Accept(ctx context.Context, stage *drone.Stage) error {
+	return r.replay("Accept", stage)
+}
+
+// Detail gets the build stage details for execution.
+func (r *Replayer) Detail(ctx context.Context, stage *drone.Stage) (*client.Context, error) {
+	var out *client.Context
+	err := r.replay("Detail", &out)
+	return out, err
+}
+
+// Update updates the build stage.
+func (r *Replayer) Update(ctx context.Context, stage *drone.Stage) error {
+	return r.replay("Update", stage)
+}
+
+// UpdateStep updates the build step.
+func (r *Replayer) UpdateStep(ctx context.Context, step *drone.Step) error {
+	return r.replay("UpdateStep", step)
+}
+
+// Watch watches for build cancellation requests. If all
+// recorded calls are replayed, Watch blocks until the
+// context is canceled.
+func (r *Replayer) Watch(ctx context.Context, build int64) (bool, error) {
+	call, ok := r.pop("Watch")
+	if !ok {
+		<-ctx.Done()
+		return false, ctx.Err()
+	}
+	var done bool
+	err := decode(call, &done)
+	return done, err
+}
+
+// Batch batch writes logs to the build logs.
+func (r *Replayer) Batch(ctx context.Context, step int64, lines []*drone.Line) error {
+	// the number of batch calls depends on timing and is
+	// not deterministic, therefore unrecorded calls are
+	// ignored.
+	call, ok := r.pop("Batch")
+	if !ok {
+		return nil
+	}
+	return decode(call, nil)
+}
+
+// Upload uploads the full logs to the server.
+func (r *Replayer) Upload(ctx context.Context, step int64, lines []*drone.Line) error {
+	return r.replay("Upload", nil)
+}
+
+// UploadCard uploads a card to drone server.
+func (r *Replayer) UploadCard(ctx context.Context, step int64, card *drone.CardInput) error {
+	return r.replay("UploadCard", nil)
+}
+
+// replay removes the next recorded call for the method from
+// the queue, decodes the recorded result into out, and
+// returns the recorded error.
+func (r *Replayer) replay(method string, out interface{}) error {
+	call, ok := r.pop(method)
+	if !ok {
+		return fmt.Errorf("clienttest: no recorded %s call", method)
+	}
+	return decode(call, out)
+}
+
+// pop removes the next recorded call for the method from the
+// queue, and returns false if all calls are replayed.
+func (r *Replayer) pop(method string) (*Call, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calls := r.calls[method]
+	if len(calls) == 0 {
+		return nil, false
+	}
+	r.calls[method] = calls[1:]
+	return calls[0], true
+}
+
+// helper function decodes the recorded result into out, and
+// returns the recorded error.
+func decode(call *Call, out interface{}) error {
+	if out != nil && len(call.Result) != 0 {
+		if err := json.Unmarshal(call.Result, out); err != nil {
+			return err
+		}
+	}
+	return toError(call.Error)
+}
+
+// helper function converts the recorded error message to
+// an error. Known errors are converted to the sentinel
+// value so they can be compared by the caller.
+func toError(s string) error {
+	switch s {
+	case "":
+		return nil
+	case client.ErrOptimisticLock.Error():
+		return client.ErrOptimisticLock
+	case context.Canceled.Error():
+		return context.Canceled
+	case context.DeadlineExceeded.Error():
+		return context.DeadlineExceeded
+	default:
+		return errors.New(s)
+	}
+}
@@ -0,0 +1,528 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package clienttest
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+	"github.com/drone/runner-go/internal"
+)
+
+// default long-polling timeout.
+const defaultPollTimeout = 30 * time.Second
+
+// Server is an in-memory implementation of the runner API
+// used by the HTTPClient. It can be used with the
+// httptest package to test runners end-to-end without a
+// Drone server.
+type Server struct {
+	// Secret is the shared secret. If set, requests must
+	// include the secret in the X-Drone-Token header.
+	Secret string
+
+	// PollTimeout is the duration after which long-polling
+	// requests are disconnected with a 204 no content
+	// response. If zero, the default timeout is used.
+	PollTimeout time.Duration
+
+	mu       sync.Mutex
+	queue    []int64
+	contexts map[int64]*client.Context
+	steps    map[int64]*drone.Step
+	logs     map[int64][]*drone.Line
+	cards    map[int64]*drone.CardInput
+	canceled map[int64]bool
+	nodes    map[string]*client.Node
+	pings    int
+	sequence int64
+	changed  chan struct{}
+}
+
+// NewServer returns a new in-memory server.
+func NewServer() *Server {
+	return &Server{
+		contexts: map[int64]*client.Context{},
+		steps:    map[int64]*drone.Step{},
+		logs:     map[int64][]*drone.Line{},
+		cards:    map[int64]*drone.CardInput{},
+		canceled: map[int64]bool{},
+		nodes:    map[string]*client.Node{},
+		changed:  make(chan struct{}),
+	}
+}
+
+// Enqueue adds the stage to the queue. The stage is
+// returned to runners that request a stage matching the
+// stage kind, type and platform. If the stage identifier
+// is zero, a unique identifier is assigned.
+func (s *Server) Enqueue(data *client.Context) *drone.Stage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stage := data.Stage
+	if stage.ID == 0 {
+		s.sequence++
+		stage.ID = s.sequence
+	}
+	if stage.Status == "" {
+		stage.Status = drone.StatusPending
+	}
+	if data.Build != nil && stage.BuildID == 0 {
+		stage.BuildID = data.Build.ID
+	}
+	s.contexts[stage.ID] = data
+	s.queue = append(s.queue, stage.ID)
+	s.notify()
+	return stage
+}
+
+// Cancel cancels the build. Runners watching the build
+// for cancellation requests are notified.
+func (s *Server) Cancel(build int64) {
+	s.mu.Lock()
+	s.canceled[build] = true
+	s.notify()
+	s.mu.Unlock()
+}
+
+// Stage returns a copy of the stage.
+func (s *Server) Stage(id int64) (*drone.Stage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.contexts[id]
+	if !ok {
+		return nil, false
+	}
+	stage := *data.Stage
+	return &stage, true
+}
+
+// Step returns a copy of the step.
+func (s *Server) Step(id int64) (*drone.Step, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	step, ok := s.steps[id]
+	if !ok {
+		return nil, false
+	}
+	out := *step
+	return &out, true
+}
+
+// Logs returns the logs written to the step.
+func (s *Server) Logs(step int64) []*drone.Line {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*drone.Line(nil), s.logs[step]...)
+}
+
+// Card returns the card uploaded to the step.
+func (s *Server) Card(step int64) (*drone.CardInput, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	card, ok := s.cards[step]
+	return card, ok
+}
+
+// Node returns a copy of the registered node.
+func (s *Server) Node(machine string) (*client.Node, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	node, ok := s.nodes[machine]
+	if !ok {
+		return nil, false
+	}
+	out := *node
+	return &out, true
+}
+
+// Pings returns the number of ping requests received.
+func (s *Server) Pings() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pings
+}
+
+// Wait blocks until the stage is complete or the timeout
+// expires, and returns the stage.
+func (s *Server) Wait(id int64, timeout time.Duration) (*drone.Stage, bool) {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		data, ok := s.contexts[id]
+		done := ok && isDone(data.Stage.Status)
+		changed := s.changed
+		s.mu.Unlock()
+		if done {
+			return s.Stage(id)
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			return s.Stage(id)
+		}
+	}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Secret != "" && r.Header.Get("X-Drone-Token") != s.Secret {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer reader.Close()
+		r.Body = reader
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/rpc/v2/"), "/")
+	switch {
+	case match(r, parts, "POST", "ping"):
+		s.handlePing(w, r)
+	case match(r, parts, "POST", "nodes", "*"),
+		match(r, parts, "PUT", "nodes", "*"):
+		s.handleNode(w, r, parts[1])
+	case match(r, parts, "DELETE", "nodes", "*"):
+		s.handleLeave(w, r, parts[1])
+	case match(r, parts, "POST", "stage"):
+		s.handleRequest(w, r)
+	case match(r, parts, "POST", "stage", "*"):
+		s.handleAccept(w, r, id(parts[1]))
+	case match(r, parts, "GET", "stage", "*"):
+		s.handleDetail(w, r, id(parts[1]))
+	case match(r, parts, "PUT", "stage", "*"):
+		s.handleUpdate(w, r, id(parts[1]))
+	case match(r, parts, "PUT", "step", "*"):
+		s.handleUpdateStep(w, r, id(parts[1]))
+	case match(r, parts, "POST", "build", "*", "watch"):
+		s.handleWatch(w, r, id(parts[1]))
+	case match(r, parts, "POST", "step", "*", "logs", "batch"):
+		s.handleBatch(w, r, id(parts[1]))
+	case match(r, parts, "POST", "step", "*", "logs", "upload"):
+		s.handleUpload(w, r, id(parts[1]))
+	case match(r, parts, "POST", "step", "*", "card"):
+		s.handleCard(w, r, id(parts[1]))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) handlePing(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.pings++
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleNode registers the node, or updates the status of
+// the registered node.
+func (s *Server) handleNode(w http.ResponseWriter, r *http.Request, machine string) {
+	node := new(client.Node)
+	if err := json.NewDecoder(r.Body).Decode(node); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	node.Machine = machine
+	s.mu.Lock()
+	s.nodes[machine] = node
+	s.notify()
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleLeave removes the registered node.
+func (s *Server) handleLeave(w http.ResponseWriter, r *http.Request, machine string) {
+	s.mu.Lock()
+	delete(s.nodes, machine)
+	s.notify()
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleRequest returns the next pending stage matching the
+// filter. If no stage is available the request blocks until
+// a stage is enqueued or the poll timeout expires.
+func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
+	filter := new(client.Filter)
+	if err := json.NewDecoder(r.Body).Decode(filter); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	timeout := time.After(s.pollTimeout())
+	for {
+		s.mu.Lock()
+		for _, id := range s.queue {
+			stage := s.contexts[id].Stage
+			if stage.Machine == "" && matchFilter(stage, filter) {
+				// the stage is copied while holding the lock,
+				// since it may be accepted concurrently.
+				stage = internal.CloneStage(stage)
+				s.mu.Unlock()
+				writeJSON(w, stage)
+				return
+			}
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-timeout:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// handleAccept assigns the stage to the machine. A conflict
+// is returned if the stage is already assigned.
+func (s *Server) handleAccept(w http.ResponseWriter, r *http.Request, id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.contexts[id]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	stage := data.Stage
+	if stage.Machine != "" {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	stage.Machine = r.FormValue("machine")
+	stage.Version++
+	stage.Updated = time.Now().Unix()
+	for i, v := range s.queue {
+		if v == id {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			break
+		}
+	}
+	s.notify()
+	writeJSON(w, stage)
+}
+
+func (s *Server) handleDetail(w http.ResponseWriter, r *http.Request, id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.contexts[id]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, data)
+}
+
+// handleUpdate updates the stage and creates the stage
+// steps. A conflict is returned if the stage version does
+// not match the current version.
+func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request, id int64) {
+	in := new(drone.Stage)
+	if err := json.NewDecoder(r.Body).Decode(in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.contexts[id]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if in.Version != data.Stage.Version {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	for _, step := range in.Steps {
+		if step.ID == 0 {
+			s.sequence++
+			step.ID = s.sequence
+			step.StageID = id
+			step.Version = 1
+		}
+		s.steps[step.ID] = step
+	}
+	in.ID = id
+	in.Version++
+	in.Updated = time.Now().Unix()
+	data.Stage = in
+	s.notify()
+	writeJSON(w, in)
+}
+
+// handleUpdateStep updates the step. A conflict is returned
+// if the step version does not match the current version.
+func (s *Server) handleUpdateStep(w http.ResponseWriter, r *http.Request, id int64) {
+	in := new(drone.Step)
+	if err := json.NewDecoder(r.Body).Decode(in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.steps[id]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if in.Version != current.Version {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	in.ID = id
+	in.Version++
+	*current = *in
+	s.notify()
+	writeJSON(w, in)
+}
+
+// handleWatch blocks until the build is canceled, in which
+// case a 200 status is returned, or the poll timeout
+// expires, in which case a 204 status is returned.
+func (s *Server) handleWatch(w http.ResponseWriter, r *http.Request, id int64) {
+	timeout := time.After(s.pollTimeout())
+	for {
+		s.mu.Lock()
+		canceled := s.canceled[id]
+		changed := s.changed
+		s.mu.Unlock()
+		if canceled {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) handleBatch(w http.ResponseWriter, r *http.Request, id int64) {
+	var lines []*drone.Line
+	if err := json.NewDecoder(r.Body).Decode(&lines); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.logs[id] = append(s.logs[id], lines...)
+	s.notify()
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request, id int64) {
+	var lines []*drone.Line
+	if err := json.NewDecoder(r.Body).Decode(&lines); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.logs[id] = lines
+	s.notify()
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleCard(w http.ResponseWriter, r *http.Request, id int64) {
+	card := new(drone.CardInput)
+	if err := json.NewDecoder(r.Body).Decode(card); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.cards[id] = card
+	s.notify()
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+// notify notifies long-polling requests that the server
+// state changed. The caller must hold the lock.
+func (s *Server) notify() {
+	if s.changed != nil {
+		close(s.changed)
+	}
+	s.changed = make(chan struct{})
+}
+
+func (s *Server) pollTimeout() time.Duration {
+	if s.PollTimeout <= 0 {
+		return defaultPollTimeout
+	}
+	return s.PollTimeout
+}
+
+// helper function returns true if the request method and
+// path segments match the pattern. The wildcard segment
+// matches any value.
+func match(r *http.Request, parts []string, method string, pattern ...string) bool {
+	if r.Method != method || len(parts) != len(pattern) {
+		return false
+	}
+	for i, v := range pattern {
+		if v != "*" && v != parts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// helper function returns true if the stage matches the
+// filter. Empty filter values match any stage.
+func matchFilter(stage *drone.Stage, filter *client.Filter) bool {
+	return matchValue(filter.Kind, stage.Kind) &&
+		matchValue(filter.Type, stage.Type) &&
+		matchValue(filter.OS, stage.OS) &&
+		matchValue(filter.Arch, stage.Arch)
+}
+
+func matchValue(want, got string) bool {
+	return want == "" || got == "" || want == got
+}
+
+// helper function returns true if the status is a
+// terminal status.
+func isDone(status string) bool {
+	switch status {
+	case drone.StatusWaiting,
+		drone.StatusPending,
+		drone.StatusRunning,
+		drone.StatusBlocked:
+		return false
+	default:
+		return true
+	}
+}
+
+// helper function parses the identifier.
+func id(s string) int64 {
+	v, _ := strconv.ParseInt(s, 10, 64)
+	return v
+}
+
+// helper function writes the json encoded value.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(v)
+}
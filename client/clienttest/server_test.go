@@ -0,0 +1,171 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package clienttest
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+)
+
+var noContext = context.Background()
+
+func TestServer(t *testing.T) {
+	server := NewServer()
+	server.Secret = "correct-horse-battery-staple"
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	server.Enqueue(&client.Context{
+		Build: &drone.Build{ID: 1},
+		Repo:  &drone.Repo{ID: 1, Slug: "octocat/hello-world"},
+		Stage: &drone.Stage{Name: "default", Kind: "pipeline", Type: "docker"},
+	})
+
+	c := client.New(ts.URL, server.Secret, false)
+	if err := c.Ping(noContext, "localhost"); err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := server.Pings(), 1; got != want {
+		t.Errorf("Want %d pings, got %d", want, got)
+	}
+
+	stage, err := c.Request(noContext, &client.Filter{Kind: "pipeline", Type: "docker"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := stage.Name, "default"; got != want {
+		t.Errorf("Want stage %q, got %q", want, got)
+	}
+
+	stage.Machine = "localhost"
+	if err := c.Accept(noContext, stage); err != nil {
+		t.Error(err)
+		return
+	}
+	dup := *stage
+	if err := c.Accept(noContext, &dup); err != client.ErrOptimisticLock {
+		t.Errorf("Want optimistic lock error accepting stage twice, got %v", err)
+	}
+
+	data, err := c.Detail(noContext, stage)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := data.Repo.Slug, "octocat/hello-world"; got != want {
+		t.Errorf("Want repository %q, got %q", want, got)
+	}
+
+	stage.Status = drone.StatusRunning
+	stage.Started = time.Now().Unix()
+	stage.Steps = []*drone.Step{
+		{Number: 1, Name: "build", StageID: stage.ID, Status: drone.StatusPending},
+	}
+	if err := c.Update(noContext, stage); err != nil {
+		t.Error(err)
+		return
+	}
+	step := stage.Steps[0]
+	if step.ID == 0 {
+		t.Errorf("Want step identifier assigned")
+	}
+
+	step.Status = drone.StatusPassing
+	if err := c.UpdateStep(noContext, step); err != nil {
+		t.Error(err)
+		return
+	}
+	if got, _ := server.Step(step.ID); got.Status != drone.StatusPassing {
+		t.Errorf("Want step status %q, got %q", drone.StatusPassing, got.Status)
+	}
+
+	lines := []*drone.Line{{Number: 0, Message: "hello world\n"}}
+	if err := c.Batch(noContext, step.ID, lines); err != nil {
+		t.Error(err)
+	}
+	if err := c.Upload(noContext, step.ID, lines); err != nil {
+		t.Error(err)
+	}
+	if got := server.Logs(step.ID); len(got) != 1 {
+		t.Errorf("Want uploaded logs replace streamed logs, got %d lines", len(got))
+	}
+	card := &drone.CardInput{Schema: "https://example.com/schema.json"}
+	if err := c.UploadCard(noContext, step.ID, card); err != nil {
+		t.Error(err)
+	}
+	if _, ok := server.Card(step.ID); !ok {
+		t.Errorf("Want card uploaded")
+	}
+
+	stage.Status = drone.StatusPassing
+	if err := c.Update(noContext, stage); err != nil {
+		t.Error(err)
+	}
+	if got, _ := server.Wait(stage.ID, time.Second); got.Status != drone.StatusPassing {
+		t.Errorf("Want stage status %q, got %q", drone.StatusPassing, got.Status)
+	}
+}
+
+func TestServer_Watch(t *testing.T) {
+	server := NewServer()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		server.Cancel(1)
+	}()
+
+	c := client.New(ts.URL, "", false)
+	done, err := c.Watch(noContext, 1)
+	if err != nil {
+		t.Error(err)
+	}
+	if !done {
+		t.Errorf("Want build canceled")
+	}
+}
+
+func TestServer_Unauthorized(t *testing.T) {
+	server := NewServer()
+	server.Secret = "correct-horse-battery-staple"
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	c := client.New(ts.URL, "incorrect", false)
+	if err := c.Ping(noContext, "localhost"); err == nil {
+		t.Errorf("Want unauthorized error")
+	}
+}
+
+func TestServer_Node(t *testing.T) {
+	server := NewServer()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	c := client.New(ts.URL, "", false)
+	if err := c.Join(noContext, "localhost"); err != nil {
+		t.Error(err)
+	}
+	if err := c.Heartbeat(noContext, &client.Node{Machine: "localhost", Capacity: 2}); err != nil {
+		t.Error(err)
+	}
+	if node, ok := server.Node("localhost"); !ok || node.Capacity != 2 {
+		t.Errorf("Want node registered with heartbeat status, got %+v", node)
+	}
+	if err := c.Leave(noContext, "localhost"); err != nil {
+		t.Error(err)
+	}
+	if _, ok := server.Node("localhost"); ok {
+		t.Errorf("Want node removed when leaving the cluster")
+	}
+}
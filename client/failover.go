@@ -0,0 +1,384 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/logger"
+)
+
+var _ Client = (*Failover)(nil)
+var _ Heartbeater = (*Failover)(nil)
+
+// ErrNoEndpoint is returned when no server endpoint is
+// available.
+var ErrNoEndpoint = errors.New("No Server Endpoint Available")
+
+// default health check configuration.
+const (
+	defaultFailoverInterval    = 10 * time.Second
+	defaultFailoverTimeout     = 5 * time.Second
+	defaultFailoverRetryBudget = 30 * time.Second
+)
+
+// Failover routes calls to one of multiple server endpoints.
+// Calls are routed to the active endpoint until it becomes
+// unavailable, at which point the client fails over to the
+// next healthy endpoint. The client does not fail back
+// when a previous endpoint recovers.
+//
+// Calls that are in-flight when the client fails over,
+// including long-polling Request and Watch calls, are
+// canceled and re-issued to the new active endpoint.
+type Failover struct {
+	// Clients provides a client for each endpoint, in
+	// order of preference.
+	Clients []Client
+
+	// Machine is the machine name sent with health checks.
+	Machine string
+
+	// Interval is the interval between health checks of
+	// the active endpoint.
+	Interval time.Duration
+
+	// Timeout is the timeout for health checks.
+	Timeout time.Duration
+
+	// RetryBudget bounds the time spent retrying a call
+	// before the client fails over.
+	RetryBudget time.Duration
+
+	Logger logger.Logger
+
+	mu      sync.Mutex
+	active  int
+	changed chan struct{}
+}
+
+// NewFailover returns a Client that fails over between the
+// server endpoints.
+func NewFailover(endpoints []string, secret string, skipverify bool) *Failover {
+	f := &Failover{
+		Interval:    defaultFailoverInterval,
+		Timeout:     defaultFailoverTimeout,
+		RetryBudget: defaultFailoverRetryBudget,
+	}
+	for _, endpoint := range endpoints {
+		f.Clients = append(f.Clients, New(endpoint, secret, skipverify))
+	}
+	return f
+}
+
+// Active returns the client for the active endpoint.
+func (f *Failover) Active() Client {
+	client, _ := f.current()
+	return client
+}
+
+// Check returns the active endpoint, and an error if no
+// endpoint is configured. It can be used as a health check.
+func (f *Failover) Check() (string, error) {
+	client, _ := f.current()
+	switch v := client.(type) {
+	case nil:
+		return "", ErrNoEndpoint
+	case *HTTPClient:
+		return v.Endpoint, nil
+	default:
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return fmt.Sprintf("endpoint %d", f.active), nil
+	}
+}
+
+// Start periodically checks the health of the active
+// endpoint, and fails over to the next healthy endpoint
+// if the active endpoint is unavailable. It blocks until
+// the context is canceled.
+func (f *Failover) Start(ctx context.Context) {
+	interval := f.Interval
+	if interval <= 0 {
+		interval = defaultFailoverInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			client, _ := f.current()
+			if client == nil {
+				continue
+			}
+			if err := f.ping(ctx, client); err != nil && ctx.Err() == nil {
+				f.logger().WithError(err).
+					Warnln("failover: active endpoint is unavailable")
+				f.failover(ctx, client)
+			}
+		}
+	}
+}
+
+// Join notifies the server the runner is joining the cluster.
+func (f *Failover) Join(ctx context.Context, machine string) error {
+	return f.call(ctx, func(ctx context.Context, client Client) error {
+		return client.Join(ctx, machine)
+	})
+}
+
+// Leave notifies the server the runner is leaving the cluster.
+func (f *Failover) Leave(ctx context.Context, machine string) error {
+	return f.call(ctx, func(ctx context.Context, client Client) error {
+		return client.Leave(ctx, machine)
+	})
+}
+
+// Ping sends a ping message to the server to test connectivity.
+func (f *Failover) Ping(ctx context.Context, machine string) error {
+	return f.poll(ctx, func(ctx context.Context, client Client) error {
+		return client.Ping(ctx, machine)
+	})
+}
+
+// Heartbeat reports the runner status to the server. If the
+// client cannot report the runner status, a ping message is
+// sent instead.
+func (f *Failover) Heartbeat(ctx context.Context, node *Node) error {
+	return f.call(ctx, func(ctx context.Context, client Client) error {
+		if c, ok := client.(Heartbeater); ok {
+			return c.Heartbeat(ctx, node)
+		}
+		return client.Ping(ctx, node.Machine)
+	})
+}
+
+// Request requests the next available build stage for execution.
+func (f *Failover) Request(ctx context.Context, args *Filter) (*drone.Stage, error) {
+	var stage *drone.Stage
+	err := f.poll(ctx, func(ctx context.Context, client Client) (err error) {
+		stage, err = client.Request(ctx, args)
+		return
+	})
+	return stage, err
+}
+
+// Accept accepts the build stage for execution.
+func (f *Failover) Accept(ctx context.Context, stage *drone.Stage) error {
+	return f.call(ctx, func(ctx context.Context, client Client) error {
+		return client.Accept(ctx, stage)
+	})
+}
+
+// Detail gets the build stage details for execution.
+func (f *Failover) Detail(ctx context.Context, stage *drone.Stage) (*Context, error) {
+	var out *Context
+	err := f.call(ctx, func(ctx context.Context, client Client) (err error) {
+		out, err = client.Detail(ctx, stage)
+		return
+	})
+	return out, err
+}
+
+// Update updates the build stage.
+func (f *Failover) Update(ctx context.Context, stage *drone.Stage) error {
+	return f.call(ctx, func(ctx context.Context, client Client) error {
+		return client.Update(ctx, stage)
+	})
+}
+
+// UpdateStep updates the build step.
+func (f *Failover) UpdateStep(ctx context.Context, step *drone.Step) error {
+	return f.call(ctx, func(ctx context.Context, client Client) error {
+		return client.UpdateStep(ctx, step)
+	})
+}
+
+// Watch watches for build cancellation requests.
+func (f *Failover) Watch(ctx context.Context, build int64) (bool, error) {
+	var done bool
+	err := f.poll(ctx, func(ctx context.Context, client Client) (err error) {
+		done, err = client.Watch(ctx, build)
+		return
+	})
+	return done, err
+}
+
+// Batch batch writes logs to the build logs.
+func (f *Failover) Batch(ctx context.Context, step int64, lines []*drone.Line) error {
+	return f.call(ctx, func(ctx context.Context, client Client) error {
+		return client.Batch(ctx, step, lines)
+	})
+}
+
+// Upload uploads the full logs to the server.
+func (f *Failover) Upload(ctx context.Context, step int64, lines []*drone.Line) error {
+	return f.call(ctx, func(ctx context.Context, client Client) error {
+		return client.Upload(ctx, step, lines)
+	})
+}
+
+// UploadCard uploads a card to drone server.
+func (f *Failover) UploadCard(ctx context.Context, step int64, card *drone.CardInput) error {
+	return f.call(ctx, func(ctx context.Context, client Client) error {
+		return client.UploadCard(ctx, step, card)
+	})
+}
+
+// call invokes the function with the active client. If the
+// call fails because the endpoint is unavailable, the client
+// fails over and the call is re-issued, at most once per
+// endpoint. A call in-flight when the client fails over is
+// not re-issued, since the call may not be idempotent.
+func (f *Failover) call(ctx context.Context, fn func(context.Context, Client) error) error {
+	return f.invoke(ctx, false, fn)
+}
+
+// poll invokes the idempotent function with the active
+// client, like call. If the client fails over while the
+// call is in-flight, the call is canceled and re-issued to
+// the new active client, so that a long-polling request is
+// not left connected to the previous endpoint.
+func (f *Failover) poll(ctx context.Context, fn func(context.Context, Client) error) error {
+	return f.invoke(ctx, true, fn)
+}
+
+// invoke invokes the function with the active client. If
+// reissue is true, a call in-flight when the client fails
+// over is canceled and re-issued.
+func (f *Failover) invoke(ctx context.Context, reissue bool, fn func(context.Context, Client) error) error {
+	budget := f.RetryBudget
+	if budget <= 0 {
+		budget = defaultFailoverRetryBudget
+	}
+	ctx = withRetryBudget(ctx, budget)
+
+	var attempts int
+	for {
+		client, changed := f.current()
+		if client == nil {
+			return ErrNoEndpoint
+		}
+		if !reissue {
+			changed = nil
+		}
+
+		// cancel the in-flight call if the client fails
+		// over to a different endpoint.
+		callctx, cancel := context.WithCancel(ctx)
+		if changed != nil {
+			go func() {
+				select {
+				case <-changed:
+					cancel()
+				case <-callctx.Done():
+				}
+			}()
+		}
+		err := fn(callctx, client)
+		cancel()
+
+		if ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-changed:
+			f.logger().Debugln("failover: re-issue call to new active endpoint")
+			continue
+		default:
+		}
+		if err == nil || !IsUnavailable(err) {
+			return err
+		}
+		attempts++
+		if attempts >= len(f.Clients) || !f.failover(ctx, client) {
+			return err
+		}
+	}
+}
+
+// current returns the active client, and a channel that is
+// closed when the client fails over.
+func (f *Failover) current() (Client, <-chan struct{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.changed == nil {
+		f.changed = make(chan struct{})
+	}
+	if len(f.Clients) == 0 {
+		return nil, f.changed
+	}
+	return f.Clients[f.active], f.changed
+}
+
+// failover fails over from the unavailable client to the
+// next healthy client, and returns true if a different
+// client is active. The endpoints are pinged without holding
+// the lock, so that calls are not blocked while the health
+// of the endpoints is checked.
+func (f *Failover) failover(ctx context.Context, from Client) bool {
+	f.mu.Lock()
+	active := f.active
+	f.mu.Unlock()
+
+	// if another call already failed over to a different
+	// client there is nothing to do.
+	if f.Clients[active] != from {
+		return true
+	}
+	for i := 1; i < len(f.Clients); i++ {
+		next := (active + i) % len(f.Clients)
+		if err := f.ping(ctx, f.Clients[next]); err != nil {
+			f.logger().WithError(err).
+				WithField("endpoint", next).
+				Debugln("failover: endpoint is unavailable")
+			continue
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		// another call may have failed over while the
+		// endpoints were pinged.
+		if f.active != active {
+			return true
+		}
+		f.logger().
+			WithField("endpoint", next).
+			Infoln("failover: switching active endpoint")
+		f.active = next
+		if f.changed != nil {
+			close(f.changed)
+		}
+		f.changed = make(chan struct{})
+		return true
+	}
+	return false
+}
+
+// ping sends a ping message to the endpoint with a timeout.
+func (f *Failover) ping(ctx context.Context, client Client) error {
+	timeout := f.Timeout
+	if timeout <= 0 {
+		timeout = defaultFailoverTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return client.Ping(ctx, f.Machine)
+}
+
+// logger is a helper function that returns the default
+// logger if a custom logger is not defined.
+func (f *Failover) logger() logger.Logger {
+	if f.Logger == nil {
+		return logger.Discard()
+	}
+	return f.Logger
+}
@@ -0,0 +1,289 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+)
+
+func TestFailover(t *testing.T) {
+	unavailable := &url.Error{Op: "Post", Err: errors.New("connection refused")}
+	a := &mockEndpoint{stage: &drone.Stage{ID: 1}, err: unavailable, ping: unavailable}
+	b := &mockEndpoint{stage: &drone.Stage{ID: 2}}
+	f := &Failover{Clients: []Client{a, b}}
+
+	stage, err := f.Request(noContext, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := stage.ID, int64(2); got != want {
+		t.Errorf("Want stage from second endpoint, got stage %d", got)
+	}
+	if f.Active() != b {
+		t.Errorf("Expect second endpoint active")
+	}
+
+	// the client should not fail back to the first endpoint
+	// once it recovers.
+	a.err, a.ping = nil, nil
+	stage, _ = f.Request(noContext, nil)
+	if got, want := stage.ID, int64(2); got != want {
+		t.Errorf("Want sticky endpoint selection, got stage %d", got)
+	}
+}
+
+func TestFailover_NoHealthyEndpoint(t *testing.T) {
+	unavailable := &url.Error{Op: "Post", Err: errors.New("connection refused")}
+	a := &mockEndpoint{err: unavailable, ping: unavailable}
+	b := &mockEndpoint{err: unavailable, ping: unavailable}
+	f := &Failover{Clients: []Client{a, b}}
+
+	_, err := f.Request(noContext, nil)
+	if err != unavailable {
+		t.Errorf("Want unavailable error, got %v", err)
+	}
+	if f.Active() != a {
+		t.Errorf("Expect first endpoint remains active")
+	}
+}
+
+func TestFailover_NoEndpoint(t *testing.T) {
+	f := new(Failover)
+	if err := f.Ping(noContext, ""); err != ErrNoEndpoint {
+		t.Errorf("Want no endpoint error, got %v", err)
+	}
+	if _, err := f.Check(); err != ErrNoEndpoint {
+		t.Errorf("Want no endpoint error, got %v", err)
+	}
+}
+
+func TestFailover_Error(t *testing.T) {
+	a := &mockEndpoint{err: errors.New("Not Found")}
+	b := &mockEndpoint{}
+	f := &Failover{Clients: []Client{a, b}}
+	if _, err := f.Request(noContext, nil); err != a.err {
+		t.Errorf("Want error returned without failover, got %v", err)
+	}
+	if f.Active() != a {
+		t.Errorf("Expect first endpoint remains active")
+	}
+}
+
+func TestFailover_LongPoll(t *testing.T) {
+	a := &mockEndpoint{block: true, waiting: make(chan struct{})}
+	b := &mockEndpoint{stage: &drone.Stage{ID: 2}}
+	f := &Failover{Clients: []Client{a, b}}
+
+	go func() {
+		a.wait()
+		f.failover(noContext, a)
+	}()
+
+	stage, err := f.Request(noContext, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := stage.ID, int64(2); got != want {
+		t.Errorf("Want long-poll re-issued to second endpoint, got stage %d", got)
+	}
+}
+
+// this test verifies that a call that is not idempotent is
+// not re-issued to the new active endpoint when the client
+// fails over while the call is in-flight.
+func TestFailover_NoReissue(t *testing.T) {
+	a := &mockAcceptEndpoint{accepting: make(chan struct{}), release: make(chan struct{})}
+	b := &mockAcceptEndpoint{}
+	f := &Failover{Clients: []Client{a, b}}
+
+	go func() {
+		<-a.accepting
+		f.failover(noContext, a)
+		close(a.release)
+	}()
+
+	if err := f.Accept(noContext, &drone.Stage{ID: 1}); err != nil {
+		t.Error(err)
+	}
+	if f.Active() != b {
+		t.Errorf("Expect second endpoint active")
+	}
+	if got, want := atomic.LoadInt32(&b.count), int32(0); got != want {
+		t.Errorf("Want in-flight accept not re-issued, got %d calls", got)
+	}
+}
+
+func TestFailover_Start(t *testing.T) {
+	unavailable := &url.Error{Op: "Post", Err: errors.New("connection refused")}
+	a := &mockEndpoint{ping: unavailable}
+	b := &mockEndpoint{}
+	f := &Failover{
+		Clients:  []Client{a, b},
+		Interval: time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(noContext, time.Second)
+	defer cancel()
+	go f.Start(ctx)
+
+	for f.Active() != b {
+		select {
+		case <-ctx.Done():
+			t.Errorf("Expect health check fails over to second endpoint")
+			return
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestFailover_Check(t *testing.T) {
+	f := NewFailover([]string{"http://a", "http://b"}, "", false)
+	status, err := f.Check()
+	if err != nil {
+		t.Error(err)
+	}
+	if got, want := status, "http://a"; got != want {
+		t.Errorf("Want active endpoint %q, got %q", want, got)
+	}
+}
+
+// this test verifies that the active client can be read
+// while the endpoints are pinged during failover.
+func TestFailover_PingUnlocked(t *testing.T) {
+	unavailable := &url.Error{Op: "Post", Err: errors.New("connection refused")}
+	a := &mockEndpoint{err: unavailable}
+	b := &mockSlowEndpoint{pinging: make(chan struct{}), release: make(chan struct{})}
+	f := &Failover{Clients: []Client{a, b}}
+
+	done := make(chan struct{})
+	go func() {
+		f.Request(noContext, nil)
+		close(done)
+	}()
+	<-b.pinging
+
+	active := make(chan Client)
+	go func() { active <- f.Active() }()
+	select {
+	case client := <-active:
+		if client != a {
+			t.Errorf("Expect first endpoint active while pinging")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expect active client readable while pinging")
+	}
+	close(b.release)
+	<-done
+	if f.Active() != b {
+		t.Errorf("Expect second endpoint active")
+	}
+}
+
+// this test verifies that the client fails over when the
+// endpoint is unavailable and the client uses the default
+// retry policy, which retries until the context is canceled.
+func TestFailover_RetryBudget(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(503)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer up.Close()
+
+	f := NewFailover([]string{down.URL, up.URL}, "", false)
+	f.RetryBudget = 50 * time.Millisecond
+	if err := f.Upload(noContext, 1, nil); err != nil {
+		t.Error(err)
+	}
+	if f.Active() != f.Clients[1] {
+		t.Errorf("Expect second endpoint active")
+	}
+}
+
+// mock client that returns a static stage and error from
+// the request method, or blocks until the context is
+// canceled.
+type mockEndpoint struct {
+	Client
+
+	sync.Mutex
+	stage   *drone.Stage
+	err     error
+	ping    error
+	block   bool
+	waiting chan struct{}
+}
+
+func (m *mockEndpoint) Ping(ctx context.Context, machine string) error {
+	m.Lock()
+	defer m.Unlock()
+	return m.ping
+}
+
+func (m *mockEndpoint) Request(ctx context.Context, args *Filter) (*drone.Stage, error) {
+	if m.block {
+		close(m.waiting)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return m.stage, m.err
+}
+
+func (m *mockEndpoint) wait() {
+	<-m.waiting
+}
+
+// mock client that counts accept calls, and blocks in the
+// accept method until released, if configured.
+type mockAcceptEndpoint struct {
+	Client
+
+	count     int32
+	accepting chan struct{}
+	release   chan struct{}
+}
+
+func (m *mockAcceptEndpoint) Ping(ctx context.Context, machine string) error {
+	return nil
+}
+
+func (m *mockAcceptEndpoint) Accept(ctx context.Context, stage *drone.Stage) error {
+	atomic.AddInt32(&m.count, 1)
+	if m.accepting != nil {
+		close(m.accepting)
+		<-m.release
+	}
+	return nil
+}
+
+// mock client that blocks in the ping method until released.
+type mockSlowEndpoint struct {
+	Client
+
+	pinging chan struct{}
+	release chan struct{}
+}
+
+func (m *mockSlowEndpoint) Ping(ctx context.Context, machine string) error {
+	close(m.pinging)
+	<-m.release
+	return nil
+}
+
+func (m *mockSlowEndpoint) Request(ctx context.Context, args *Filter) (*drone.Stage, error) {
+	return &drone.Stage{}, nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// negotiated content encodings.
+const (
+	encodingUnknown int32 = iota
+	encodingGzip
+	encodingIdentity
+)
+
+// compressible wraps an input payload that is compressed
+// if the server supports compression.
+type compressible struct {
+	in interface{}
+}
+
+// compress returns true if payloads should be compressed.
+func (p *HTTPClient) compress() bool {
+	return p.Compress &&
+		atomic.LoadInt32(&p.encoding) == encodingGzip
+}
+
+// negotiate enables compression if the server advertises
+// support for gzip encoding using the Accept-Encoding
+// response header.
+func (p *HTTPClient) negotiate(res *http.Response) {
+	if !p.Compress || !acceptsGzip(res.Header) {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&p.encoding, encodingUnknown, encodingGzip) {
+		p.logger().Tracef("http: server supports gzip encoding")
+	}
+}
+
+// helper function returns true if the Accept-Encoding
+// header includes gzip.
+func acceptsGzip(header http.Header) bool {
+	for _, v := range header["Accept-Encoding"] {
+		for _, encoding := range strings.Split(v, ",") {
+			encoding = strings.TrimSpace(encoding)
+			if i := strings.Index(encoding, ";"); i != -1 {
+				if strings.TrimSpace(encoding[i+1:]) == "q=0" {
+					continue
+				}
+				encoding = strings.TrimSpace(encoding[:i])
+			}
+			if encoding == "gzip" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// helper function returns the gzip compressed data.
+func gzipBytes(data []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
@@ -0,0 +1,147 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package client
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+)
+
+func TestCompress(t *testing.T) {
+	var mu sync.Mutex
+	var encodings []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		encodings = append(encodings, r.Header.Get("Content-Encoding"))
+		mu.Unlock()
+
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			body, _ = gzip.NewReader(r.Body)
+		}
+		var lines []*drone.Line
+		if err := json.NewDecoder(body).Decode(&lines); err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		if len(lines) != 1 || lines[0].Message != "hello" {
+			t.Errorf("Unexpected log lines")
+		}
+		w.Header().Set("Accept-Encoding", "gzip, deflate")
+		w.WriteHeader(200)
+	}))
+	defer ts.Close()
+
+	client := New(ts.URL, "", false)
+	client.Compress = true
+	lines := []*drone.Line{{Message: "hello"}}
+
+	// the first request is sent uncompressed until the
+	// server advertises support for compression.
+	if err := client.Batch(noContext, 1, lines); err != nil {
+		t.Error(err)
+	}
+	if err := client.Upload(noContext, 1, lines); err != nil {
+		t.Error(err)
+	}
+	if got, want := encodings, []string{"", "gzip"}; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Want content encodings %q, got %q", want, got)
+	}
+}
+
+func TestCompress_Fallback(t *testing.T) {
+	var count int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			w.WriteHeader(415)
+			return
+		}
+		w.WriteHeader(200)
+	}))
+	defer ts.Close()
+
+	client := New(ts.URL, "", false)
+	client.Compress = true
+	client.encoding = encodingGzip
+
+	if err := client.Batch(noContext, 1, nil); err != nil {
+		t.Error(err)
+	}
+	if got, want := count, 2; got != want {
+		t.Errorf("Want %d requests, got %d", want, got)
+	}
+	if client.compress() {
+		t.Errorf("Expect compression disabled after the server rejects compressed payloads")
+	}
+}
+
+// this test verifies that a bad request does not disable
+// compression, since the error may relate to the payload
+// content and not the encoding.
+func TestCompress_BadRequest(t *testing.T) {
+	var count int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		w.WriteHeader(400)
+	}))
+	defer ts.Close()
+
+	client := New(ts.URL, "", false)
+	client.Compress = true
+	client.encoding = encodingGzip
+
+	if err := client.Batch(noContext, 1, nil); err == nil {
+		t.Errorf("Expect bad request error")
+	}
+	if got, want := count, 1; got != want {
+		t.Errorf("Want %d requests, got %d", want, got)
+	}
+	if !client.compress() {
+		t.Errorf("Expect compression enabled after a bad request")
+	}
+}
+
+func TestCompress_Disabled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "" {
+			t.Errorf("Expect uncompressed payload")
+		}
+		w.Header().Set("Accept-Encoding", "gzip")
+	}))
+	defer ts.Close()
+
+	client := New(ts.URL, "", false)
+	client.Batch(noContext, 1, nil)
+	client.Batch(noContext, 1, nil)
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip", true},
+		{"gzip;q=0.5", true},
+		{"gzip;q=0", false},
+		{"identity", false},
+	}
+	for _, test := range tests {
+		header := http.Header{}
+		header.Set("Accept-Encoding", test.header)
+		if got := acceptsGzip(header); got != test.want {
+			t.Errorf("Want Accept-Encoding %q support is %v", test.header, test.want)
+		}
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sync/atomic"
 	"time"
 
 	"github.com/drone/drone-go/drone"
@@ -34,6 +35,14 @@ const (
 )
 
 var _ Client = (*HTTPClient)(nil)
+var _ Heartbeater = (*HTTPClient)(nil)
+
+// reconnectInterval is the interval before a long-polling
+// request is reconnected after the server disconnects the
+// request with a 204 no content response. It is independent
+// of the retry policy, which configures the retry of failed
+// requests.
+var reconnectInterval = 10 * time.Second
 
 // defaultClient is the default http.Client.
 var defaultClient = &http.Client{
@@ -73,16 +82,41 @@ type HTTPClient struct {
 	Endpoint   string
 	Secret     string
 	SkipVerify bool
+
+	// Retry configures how failed requests are retried. If
+	// nil, the DefaultRetryPolicy is used.
+	Retry *RetryPolicy
+
+	// Sign signs requests with the shared secret instead
+	// of sending the secret in the request header.
+	Sign bool
+
+	// Compress compresses log and card payloads when the
+	// server advertises support for gzip encoding.
+	Compress bool
+
+	// RetryOverrides overrides the retry policy for
+	// individual calls, keyed by method name (e.g. Request
+	// or UploadCard).
+	RetryOverrides map[string]*RetryPolicy
+
+	// encoding is the negotiated content encoding.
+	encoding int32
 }
 
 // Join notifies the server the runner is joining the cluster.
 func (p *HTTPClient) Join(ctx context.Context, machine string) error {
-	return nil
+	return p.node(ctx, "POST", machine, &Node{Machine: machine})
 }
 
 // Leave notifies the server the runner is leaving the cluster.
 func (p *HTTPClient) Leave(ctx context.Context, machine string) error {
-	return nil
+	return p.node(ctx, "DELETE", machine, nil)
+}
+
+// Heartbeat reports the runner status to the server.
+func (p *HTTPClient) Heartbeat(ctx context.Context, node *Node) error {
+	return p.node(ctx, "PUT", node.Machine, node)
 }
 
 // Ping sends a ping message to the server to test connectivity.
@@ -95,7 +129,7 @@ func (p *HTTPClient) Ping(ctx context.Context, machine string) error {
 func (p *HTTPClient) Request(ctx context.Context, args *Filter) (*drone.Stage, error) {
 	src := args
 	dst := new(drone.Stage)
-	_, err := p.retry(ctx, endpointStages, "POST", src, dst)
+	_, err := p.retry(ctx, "Request", endpointStages, "POST", src, dst)
 	return dst, err
 }
 
@@ -104,7 +138,7 @@ func (p *HTTPClient) Accept(ctx context.Context, stage *drone.Stage) error {
 	uri := fmt.Sprintf(endpointStage+"?machine=%s", stage.ID, url.QueryEscape(stage.Machine))
 	src := stage
 	dst := new(drone.Stage)
-	_, err := p.retry(ctx, uri, "POST", nil, dst)
+	_, err := p.retry(ctx, "Accept", uri, "POST", nil, dst)
 	if dst != nil {
 		src.Updated = dst.Updated
 		src.Version = dst.Version
@@ -116,7 +150,7 @@ func (p *HTTPClient) Accept(ctx context.Context, stage *drone.Stage) error {
 func (p *HTTPClient) Detail(ctx context.Context, stage *drone.Stage) (*Context, error) {
 	uri := fmt.Sprintf(endpointStage, stage.ID)
 	dst := new(Context)
-	_, err := p.retry(ctx, uri, "GET", nil, dst)
+	_, err := p.retry(ctx, "Detail", uri, "GET", nil, dst)
 	return dst, err
 }
 
@@ -140,7 +174,7 @@ func (p *HTTPClient) Update(ctx context.Context, stage *drone.Stage) error {
 			return fmt.Errorf("step[%d] missing start time", i)
 		}
 	}
-	_, err := p.retry(ctx, uri, "PUT", src, dst)
+	_, err := p.retry(ctx, "Update", uri, "PUT", src, dst)
 	if dst != nil {
 		src.Updated = dst.Updated
 		src.Version = dst.Version
@@ -168,7 +202,7 @@ func (p *HTTPClient) UpdateStep(ctx context.Context, step *drone.Step) error {
 	uri := fmt.Sprintf(endpointStep, step.ID)
 	src := step
 	dst := new(drone.Step)
-	_, err := p.retry(ctx, uri, "PUT", src, dst)
+	_, err := p.retry(ctx, "UpdateStep", uri, "PUT", src, dst)
 	if dst != nil {
 		src.Version = dst.Version
 	}
@@ -178,7 +212,7 @@ func (p *HTTPClient) UpdateStep(ctx context.Context, step *drone.Step) error {
 // Watch watches for build cancellation requests.
 func (p *HTTPClient) Watch(ctx context.Context, build int64) (bool, error) {
 	uri := fmt.Sprintf(endpointWatch, build)
-	res, err := p.retry(ctx, uri, "POST", nil, nil)
+	res, err := p.retry(ctx, "Watch", uri, "POST", nil, nil)
 	if err != nil {
 		return false, err
 	}
@@ -191,25 +225,32 @@ func (p *HTTPClient) Watch(ctx context.Context, build int64) (bool, error) {
 // Batch batch writes logs to the build logs.
 func (p *HTTPClient) Batch(ctx context.Context, step int64, lines []*drone.Line) error {
 	uri := fmt.Sprintf(endpointBatch, step)
-	_, err := p.do(ctx, uri, "POST", &lines, nil)
+	_, err := p.do(ctx, uri, "POST", &compressible{&lines}, nil)
 	return err
 }
 
 // Upload uploads the full logs to the server.
 func (p *HTTPClient) Upload(ctx context.Context, step int64, lines []*drone.Line) error {
 	uri := fmt.Sprintf(endpointUpload, step)
-	_, err := p.retry(ctx, uri, "POST", &lines, nil)
+	_, err := p.retry(ctx, "Upload", uri, "POST", &compressible{&lines}, nil)
 	return err
 }
 
 // UploadCard uploads a card to drone server.
 func (p *HTTPClient) UploadCard(ctx context.Context, step int64, card *drone.CardInput) error {
 	uri := fmt.Sprintf(endpointCard, step)
-	_, err := p.retry(ctx, uri, "POST", &card, nil)
+	_, err := p.retry(ctx, "UploadCard", uri, "POST", &compressible{&card}, nil)
 	return err
 }
 
-func (p *HTTPClient) retry(ctx context.Context, path, method string, in, out interface{}) (*http.Response, error) {
+func (p *HTTPClient) retry(ctx context.Context, name, path, method string, in, out interface{}) (*http.Response, error) {
+	policy := p.retryPolicy(name)
+	maxElapsed := policy.MaxElapsedTime
+	if budget := retryBudget(ctx); budget > 0 && (maxElapsed == 0 || budget < maxElapsed) {
+		maxElapsed = budget
+	}
+	start := time.Now()
+	attempt := 0
 	for {
 		res, err := p.do(ctx, path, method, in, out)
 		// do not retry on Canceled or DeadlineExceeded
@@ -221,31 +262,62 @@ func (p *HTTPClient) retry(ctx context.Context, path, method string, in, out int
 		if err == ErrOptimisticLock {
 			return res, err
 		}
+		var wait time.Duration
 		if res != nil {
-			// Check the response code. We retry on 500-range
-			// responses to allow the server time to recover, as
-			// 500's are typically not permanent errors and may
-			// relate to outages on the server side.
-			if res.StatusCode > 501 {
-				p.logger().Tracef("http: server error: re-connect and re-try: %s", err)
-				time.Sleep(time.Second * 10)
-				continue
-			}
-			// We also retry on 204 no content response codes,
+			switch {
+			// We retry on 204 no content response codes,
 			// used by the server when a long-polling request
 			// is intentionally disconnected and should be
-			// automatically reconnected.
-			if res.StatusCode == 204 {
+			// automatically reconnected. This is not a
+			// failure and does not consume the retry budget.
+			case res.StatusCode == 204:
 				p.logger().Tracef("http: no content returned: re-connect and re-try")
-				time.Sleep(time.Second * 10)
+				start = time.Now()
+				attempt = 0
+				if err := sleep(ctx, reconnectInterval); err != nil {
+					return res, err
+				}
 				continue
+			// Check the response code. We retry on 500-range
+			// responses to allow the server time to recover, as
+			// 500's are typically not permanent errors and may
+			// relate to outages on the server side. We also
+			// retry when the server is throttling requests.
+			case res.StatusCode > 501, res.StatusCode == 429:
+				p.logger().Tracef("http: server error: re-connect and re-try: %s", err)
+				wait = policy.Interval(attempt)
+				// respect the interval requested by the
+				// server, if provided.
+				if after := retryAfter(res); after > 0 {
+					wait = after
+				}
+			default:
+				return res, err
 			}
 		} else if err != nil {
 			p.logger().Tracef("http: request error: %s", err)
-			time.Sleep(time.Second * 10)
-			continue
+			wait = policy.Interval(attempt)
+		} else {
+			return res, err
+		}
+		attempt++
+		elapsed := time.Since(start)
+		if (policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts) ||
+			(maxElapsed > 0 && elapsed+wait > maxElapsed) {
+			rerr := &RetryError{
+				Attempts: attempt,
+				Elapsed:  elapsed,
+				Err:      err,
+			}
+			if res != nil {
+				rerr.StatusCode = res.StatusCode
+			}
+			p.logger().Tracef("http: %s", rerr)
+			return res, rerr
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return res, err
 		}
-		return res, err
 	}
 }
 
@@ -254,11 +326,24 @@ func (p *HTTPClient) retry(ctx context.Context, path, method string, in, out int
 func (p *HTTPClient) do(ctx context.Context, path, method string, in, out interface{}) (*http.Response, error) {
 	var buf bytes.Buffer
 
+	// unwrap compressible input payloads, which are gzip
+	// compressed if the server supports compression.
+	compress := false
+	if v, ok := in.(*compressible); ok {
+		in = v.in
+		compress = p.compress()
+	}
+
 	// marshal the input payload into json format and copy
 	// to an io.ReadCloser.
 	if in != nil {
 		json.NewEncoder(&buf).Encode(in)
 	}
+	if compress {
+		data := gzipBytes(buf.Bytes())
+		buf.Reset()
+		buf.Write(data)
+	}
 
 	endpoint := p.Endpoint + path
 	req, err := http.NewRequest(method, endpoint, &buf)
@@ -266,10 +351,18 @@ func (p *HTTPClient) do(ctx context.Context, path, method string, in, out interf
 		return nil, err
 	}
 	req = req.WithContext(ctx)
+	if compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
 
 	// the request should include the secret shared between
-	// the agent and server for authorization.
-	req.Header.Add("X-Drone-Token", p.Secret)
+	// the agent and server for authorization, or a signature
+	// of the request computed with the shared secret.
+	if p.Sign {
+		SignRequest(req, buf.Bytes(), p.Secret)
+	} else {
+		req.Header.Add("X-Drone-Token", p.Secret)
+	}
 
 	if p.Dumper != nil {
 		p.Dumper.DumpRequest(req)
@@ -292,6 +385,19 @@ func (p *HTTPClient) do(ctx context.Context, path, method string, in, out interf
 		p.Dumper.DumpResponse(res)
 	}
 
+	// if the server rejected the compressed payload we
+	// disable compression and re-send the payload
+	// uncompressed, for compatibility with older servers.
+	// Only an unsupported media type response disables
+	// compression, since other client errors may relate
+	// to the payload content.
+	if compress && res.StatusCode == 415 {
+		p.logger().Tracef("http: compressed payload rejected: re-try uncompressed")
+		atomic.StoreInt32(&p.encoding, encodingIdentity)
+		return p.do(ctx, path, method, in, out)
+	}
+	p.negotiate(res)
+
 	// if the response body return no content we exit
 	// immediately. We do not read or unmarshal the response
 	// and we do not return an error.
@@ -333,6 +439,19 @@ func (p *HTTPClient) do(ctx context.Context, path, method string, in, out interf
 	return res, json.Unmarshal(body, out)
 }
 
+// node is a helper function that sends a node registration
+// request to the server. Older servers do not support node
+// registration, in which case the request is ignored.
+func (p *HTTPClient) node(ctx context.Context, method, machine string, in interface{}) error {
+	uri := fmt.Sprintf(endpointNode, url.PathEscape(machine))
+	res, err := p.do(ctx, uri, method, in, nil)
+	if res != nil && (res.StatusCode == 404 || res.StatusCode == 405) {
+		p.logger().Tracef("http: node registration not supported")
+		return nil
+	}
+	return err
+}
+
 // client is a helper funciton that returns the default client
 // if a custom client is not defined.
 func (p *HTTPClient) client() *http.Client {
@@ -342,6 +461,18 @@ func (p *HTTPClient) client() *http.Client {
 	return p.Client
 }
 
+// retryPolicy is a helper function that returns the retry
+// policy for the named method.
+func (p *HTTPClient) retryPolicy(name string) *RetryPolicy {
+	if policy, ok := p.RetryOverrides[name]; ok && policy != nil {
+		return policy
+	}
+	if p.Retry == nil {
+		return DefaultRetryPolicy
+	}
+	return p.Retry
+}
+
 // logger is a helper funciton that returns the default logger
 // if a custom logger is not defined.
 func (p *HTTPClient) logger() logger.Logger {
@@ -0,0 +1,160 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/drone/runner-go/logger"
+)
+
+// default heartbeat configuration.
+const (
+	defaultHeartbeatInterval = 30 * time.Second
+	defaultHeartbeatTimeout  = 10 * time.Second
+)
+
+// Node provides the runner status reported to the server
+// with each heartbeat.
+type Node struct {
+	Machine  string            `json:"machine"`
+	Version  string            `json:"version,omitempty"`
+	Kind     string            `json:"kind,omitempty"`
+	Type     string            `json:"type,omitempty"`
+	OS       string            `json:"os,omitempty"`
+	Arch     string            `json:"arch,omitempty"`
+	Capacity int               `json:"capacity"`
+	Running  int               `json:"running"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+// Heartbeater is implemented by clients that can report the
+// runner status to the server.
+type Heartbeater interface {
+	// Heartbeat reports the runner status to the server.
+	Heartbeat(ctx context.Context, node *Node) error
+}
+
+// Heartbeat registers the runner with the server and
+// periodically reports the runner status.
+type Heartbeat struct {
+	Client Client
+
+	// Machine is the name of the host machine.
+	Machine string
+
+	// Interval is the interval between heartbeats.
+	Interval time.Duration
+
+	// Timeout is the timeout for each heartbeat, and for
+	// leaving the cluster on shutdown.
+	Timeout time.Duration
+
+	// Status returns the current runner status, which is
+	// reported to the server with each heartbeat. If nil,
+	// only the machine name is reported.
+	Status func() *Node
+
+	Logger logger.Logger
+}
+
+// Start joins the cluster and sends periodic heartbeats to
+// the server. It blocks until the context is canceled, at
+// which point the runner leaves the cluster.
+func (h *Heartbeat) Start(ctx context.Context) {
+	if err := h.join(ctx); err != nil {
+		h.logger().WithError(err).
+			Warnln("heartbeat: cannot join the cluster")
+	}
+
+	interval := h.Interval
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		h.beat(ctx)
+		select {
+		case <-ctx.Done():
+			h.leave()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// join notifies the server the runner is joining the
+// cluster.
+func (h *Heartbeat) join(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout())
+	defer cancel()
+	return h.Client.Join(ctx, h.Machine)
+}
+
+// leave notifies the server the runner is leaving the
+// cluster. The parent context is already canceled, so a
+// new context is used.
+func (h *Heartbeat) leave() {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout())
+	defer cancel()
+	if err := h.Client.Leave(ctx, h.Machine); err != nil {
+		h.logger().WithError(err).
+			Warnln("heartbeat: cannot leave the cluster")
+		return
+	}
+	h.logger().Debugln("heartbeat: left the cluster")
+}
+
+// beat reports the runner status to the server. If the
+// client cannot report the runner status, a ping message
+// is sent instead.
+func (h *Heartbeat) beat(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout())
+	defer cancel()
+
+	var err error
+	if c, ok := h.Client.(Heartbeater); ok {
+		err = c.Heartbeat(ctx, h.status())
+	} else {
+		err = h.Client.Ping(ctx, h.Machine)
+	}
+	if err != nil && ctx.Err() == nil {
+		h.logger().WithError(err).
+			Warnln("heartbeat: cannot report runner status")
+	}
+}
+
+// status returns the current runner status.
+func (h *Heartbeat) status() *Node {
+	node := new(Node)
+	if h.Status != nil {
+		if v := h.Status(); v != nil {
+			node = v
+		}
+	}
+	if node.Machine == "" {
+		node.Machine = h.Machine
+	}
+	return node
+}
+
+func (h *Heartbeat) timeout() time.Duration {
+	if h.Timeout <= 0 {
+		return defaultHeartbeatTimeout
+	}
+	return h.Timeout
+}
+
+// logger is a helper function that returns the default
+// logger if a custom logger is not defined.
+func (h *Heartbeat) logger() logger.Logger {
+	if h.Logger == nil {
+		return logger.Discard()
+	}
+	return h.Logger
+}
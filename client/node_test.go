@@ -0,0 +1,164 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTPClient_Node(t *testing.T) {
+	var requests []string
+	var got *Node
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == "PUT" {
+			got = new(Node)
+			json.NewDecoder(r.Body).Decode(got)
+		}
+		w.WriteHeader(200)
+	}))
+	defer ts.Close()
+
+	c := New(ts.URL, "", false)
+	if err := c.Join(noContext, "localhost"); err != nil {
+		t.Error(err)
+	}
+	want := &Node{
+		Machine:  "localhost",
+		Version:  "1.0.0",
+		Capacity: 2,
+		Running:  1,
+		Labels:   map[string]string{"region": "us-east"},
+	}
+	if err := c.Heartbeat(noContext, want); err != nil {
+		t.Error(err)
+	}
+	if err := c.Leave(noContext, "localhost"); err != nil {
+		t.Error(err)
+	}
+
+	wantRequests := []string{
+		"POST /rpc/v2/nodes/localhost",
+		"PUT /rpc/v2/nodes/localhost",
+		"DELETE /rpc/v2/nodes/localhost",
+	}
+	if len(requests) != len(wantRequests) {
+		t.Errorf("Want requests %v, got %v", wantRequests, requests)
+		return
+	}
+	for i := range wantRequests {
+		if requests[i] != wantRequests[i] {
+			t.Errorf("Want request %q, got %q", wantRequests[i], requests[i])
+		}
+	}
+	if got == nil || got.Capacity != 2 || got.Running != 1 || got.Labels["region"] != "us-east" {
+		t.Errorf("Want heartbeat to include runner status, got %+v", got)
+	}
+}
+
+func TestHTTPClient_NodeNotSupported(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	c := New(ts.URL, "", false)
+	if err := c.Join(noContext, "localhost"); err != nil {
+		t.Errorf("Want node registration ignored by older servers, got %s", err)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	mock := new(mockHeartbeater)
+	ctx, cancel := context.WithCancel(noContext)
+	h := &Heartbeat{
+		Client:   mock,
+		Machine:  "localhost",
+		Interval: time.Millisecond,
+		Status: func() *Node {
+			return &Node{Capacity: 2}
+		},
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	h.Start(ctx)
+
+	mock.Lock()
+	defer mock.Unlock()
+	if !mock.joined {
+		t.Errorf("Want runner joined the cluster")
+	}
+	if !mock.left {
+		t.Errorf("Want runner left the cluster on shutdown")
+	}
+	if len(mock.beats) < 2 {
+		t.Errorf("Want periodic heartbeats, got %d", len(mock.beats))
+		return
+	}
+	if got := mock.beats[0]; got.Machine != "localhost" || got.Capacity != 2 {
+		t.Errorf("Want heartbeat to include runner status, got %+v", got)
+	}
+}
+
+func TestHeartbeat_Ping(t *testing.T) {
+	mock := new(mockPinger)
+	ctx, cancel := context.WithCancel(noContext)
+	cancel()
+	h := &Heartbeat{Client: mock, Machine: "localhost"}
+	h.Start(ctx)
+	if mock.pings == 0 {
+		t.Errorf("Want ping when the client cannot report runner status")
+	}
+}
+
+// mock client that records node registration calls.
+type mockHeartbeater struct {
+	Client
+
+	sync.Mutex
+	joined bool
+	left   bool
+	beats  []*Node
+}
+
+func (m *mockHeartbeater) Join(ctx context.Context, machine string) error {
+	m.Lock()
+	m.joined = true
+	m.Unlock()
+	return nil
+}
+
+func (m *mockHeartbeater) Leave(ctx context.Context, machine string) error {
+	m.Lock()
+	m.left = ctx.Err() == nil
+	m.Unlock()
+	return nil
+}
+
+func (m *mockHeartbeater) Heartbeat(ctx context.Context, node *Node) error {
+	m.Lock()
+	m.beats = append(m.beats, node)
+	m.Unlock()
+	return nil
+}
+
+// mock client that cannot report the runner status.
+type mockPinger struct {
+	Client
+	pings int
+}
+
+func (m *mockPinger) Join(context.Context, string) error  { return nil }
+func (m *mockPinger) Leave(context.Context, string) error { return nil }
+func (m *mockPinger) Ping(context.Context, string) error {
+	m.pings++
+	return nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// random returns a pseudo-random number in [0.0,1.0).
+var random = rand.Float64
+
+// DefaultRetryPolicy is the default retry policy. Requests
+// are retried with exponential backoff and jitter until
+// the context is canceled.
+var DefaultRetryPolicy = &RetryPolicy{
+	InitialInterval: time.Second,
+	MaxInterval:     time.Minute,
+	Multiplier:      2,
+	Jitter:          0.5,
+}
+
+// RetryPolicy configures how failed requests are retried.
+type RetryPolicy struct {
+	// InitialInterval is the interval before the first
+	// retry attempt.
+	InitialInterval time.Duration
+
+	// MaxInterval caps the interval between attempts.
+	MaxInterval time.Duration
+
+	// Multiplier is the factor by which the interval
+	// increases after each attempt.
+	Multiplier float64
+
+	// Jitter is the randomization factor applied to the
+	// interval, between 0 and 1. An interval of 10s with a
+	// jitter of 0.5 results in a random interval between
+	// 5s and 15s, which prevents a large number of runners
+	// from retrying in lockstep.
+	Jitter float64
+
+	// MaxElapsedTime is the maximum amount of time spent
+	// retrying a request. A zero value retries until the
+	// context is canceled.
+	MaxElapsedTime time.Duration
+
+	// MaxAttempts is the maximum number of attempts. A
+	// zero value does not limit the number of attempts.
+	MaxAttempts int
+}
+
+// Interval returns the interval before the retry attempt
+// with jitter applied, where zero is the first retry.
+func (p *RetryPolicy) Interval(attempt int) time.Duration {
+	interval := float64(p.InitialInterval)
+	if p.Multiplier > 1 {
+		interval = interval * math.Pow(p.Multiplier, float64(attempt))
+	}
+	if max := float64(p.MaxInterval); max > 0 && interval > max {
+		interval = max
+	}
+	if p.Jitter > 0 {
+		interval = interval * (1 + p.Jitter*(2*random()-1))
+	}
+	return time.Duration(interval)
+}
+
+// retryBudgetKey is the context key for the retry budget.
+type retryBudgetKey struct{}
+
+// withRetryBudget returns a context that bounds the time
+// spent retrying requests made with the context. A client
+// that wraps the HTTPClient uses the budget to ensure a call
+// to an unavailable server fails, even if the retry policy
+// retries until the context is canceled. A smaller budget
+// configured on the parent context is preserved.
+func withRetryBudget(ctx context.Context, budget time.Duration) context.Context {
+	if budget <= 0 {
+		return ctx
+	}
+	if prev := retryBudget(ctx); prev > 0 && prev <= budget {
+		return ctx
+	}
+	return context.WithValue(ctx, retryBudgetKey{}, budget)
+}
+
+// retryBudget returns the retry budget from the context, or
+// zero if the context does not have a retry budget.
+func retryBudget(ctx context.Context) time.Duration {
+	budget, _ := ctx.Value(retryBudgetKey{}).(time.Duration)
+	return budget
+}
+
+// RetryError is returned when the retry budget for a
+// request is exhausted.
+type RetryError struct {
+	// Attempts is the number of attempts made.
+	Attempts int
+
+	// Elapsed is the time spent retrying the request.
+	Elapsed time.Duration
+
+	// StatusCode is the status code of the last response,
+	// or zero if the last attempt did not receive a
+	// response.
+	StatusCode int
+
+	// Err is the error returned by the last attempt.
+	Err error
+}
+
+// Error returns the error message.
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("http: retry budget exhausted after %d attempts in %s: %s",
+		e.Attempts, e.Elapsed.Round(time.Millisecond), e.Err)
+}
+
+// Unwrap returns the error returned by the last attempt.
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// helper function returns the interval requested by the
+// server in the Retry-After header, or zero if the header
+// is missing or invalid.
+func retryAfter(res *http.Response) time.Duration {
+	v := res.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// helper function sleeps for the duration, returning early
+// with an error if the context is canceled.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
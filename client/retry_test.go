@@ -0,0 +1,243 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+)
+
+func TestRetryPolicyInterval(t *testing.T) {
+	defer func(fn func() float64) {
+		random = fn
+	}(random)
+	random = func() float64 { return 0.5 }
+
+	policy := &RetryPolicy{
+		InitialInterval: time.Second,
+		MaxInterval:     10 * time.Second,
+		Multiplier:      2,
+	}
+	tests := []struct {
+		attempt  int
+		interval time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{4, 10 * time.Second},
+		{10, 10 * time.Second},
+	}
+	for _, test := range tests {
+		if got, want := policy.Interval(test.attempt), test.interval; got != want {
+			t.Errorf("Want attempt %d interval %s, got %s", test.attempt, want, got)
+		}
+	}
+
+	policy.Jitter = 0.5
+	random = func() float64 { return 0 }
+	if got, want := policy.Interval(0), 500*time.Millisecond; got != want {
+		t.Errorf("Want minimum jitter interval %s, got %s", want, got)
+	}
+	random = func() float64 { return 1 }
+	if got, want := policy.Interval(0), 1500*time.Millisecond; got != want {
+		t.Errorf("Want maximum jitter interval %s, got %s", want, got)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"id":1}`))
+	}))
+	defer ts.Close()
+
+	client := New(ts.URL, "", false)
+	client.Retry = &RetryPolicy{InitialInterval: time.Millisecond}
+	stage, err := client.Request(noContext, &Filter{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := stage.ID, int64(1); got != want {
+		t.Errorf("Want stage id %d, got %d", want, got)
+	}
+	if got, want := atomic.LoadInt32(&count), int32(3); got != want {
+		t.Errorf("Want %d attempts, got %d", want, got)
+	}
+}
+
+// this test verifies that a long-polling request is
+// reconnected after the reconnect interval when the server
+// returns no content, and not after the retry interval.
+func TestRetry_NoContent(t *testing.T) {
+	defer func(d time.Duration) {
+		reconnectInterval = d
+	}(reconnectInterval)
+	reconnectInterval = 50 * time.Millisecond
+
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte(`{"id":1}`))
+	}))
+	defer ts.Close()
+
+	client := New(ts.URL, "", false)
+	client.Retry = &RetryPolicy{InitialInterval: time.Millisecond}
+	start := time.Now()
+	if _, err := client.Request(noContext, &Filter{}); err != nil {
+		t.Error(err)
+		return
+	}
+	if elapsed := time.Since(start); elapsed < reconnectInterval {
+		t.Errorf("Want reconnect after %s, got %s", reconnectInterval, elapsed)
+	}
+	if got, want := atomic.LoadInt32(&count), int32(2); got != want {
+		t.Errorf("Want %d requests, got %d", want, got)
+	}
+}
+
+func TestRetry_MaxAttempts(t *testing.T) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	client := New(ts.URL, "", false)
+	client.Retry = &RetryPolicy{InitialInterval: time.Millisecond, MaxAttempts: 3}
+	_, err := client.Detail(noContext, &drone.Stage{ID: 1})
+	rerr, ok := err.(*RetryError)
+	if !ok {
+		t.Errorf("Want retry error, got %v", err)
+		return
+	}
+	if got, want := rerr.Attempts, 3; got != want {
+		t.Errorf("Want %d attempts, got %d", want, got)
+	}
+	if got, want := rerr.StatusCode, http.StatusServiceUnavailable; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+	if got, want := atomic.LoadInt32(&count), int32(3); got != want {
+		t.Errorf("Want %d requests, got %d", want, got)
+	}
+}
+
+func TestRetry_MaxElapsedTime(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	client := New(ts.URL, "", false)
+	client.Retry = &RetryPolicy{
+		InitialInterval: 10 * time.Millisecond,
+		MaxElapsedTime:  50 * time.Millisecond,
+		Multiplier:      2,
+	}
+	_, err := client.Detail(noContext, &drone.Stage{ID: 1})
+	if _, ok := err.(*RetryError); !ok {
+		t.Errorf("Want retry error, got %v", err)
+	}
+}
+
+func TestRetry_Override(t *testing.T) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	client := New(ts.URL, "", false)
+	client.Retry = &RetryPolicy{InitialInterval: time.Millisecond, MaxAttempts: 5}
+	client.RetryOverrides = map[string]*RetryPolicy{
+		"UploadCard": {InitialInterval: time.Millisecond, MaxAttempts: 1},
+	}
+	err := client.UploadCard(noContext, 1, nil)
+	if _, ok := err.(*RetryError); !ok {
+		t.Errorf("Want retry error, got %v", err)
+	}
+	if got, want := atomic.LoadInt32(&count), int32(1); got != want {
+		t.Errorf("Want %d requests, got %d", want, got)
+	}
+}
+
+func TestRetry_RetryAfter(t *testing.T) {
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	client := New(ts.URL, "", false)
+	client.Retry = &RetryPolicy{InitialInterval: time.Millisecond}
+	start := time.Now()
+	err := client.UploadCard(noContext, 1, nil)
+	if err != nil {
+		t.Error(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Expect client to wait for Retry-After interval, waited %s", elapsed)
+	}
+}
+
+func TestRetry_Canceled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(noContext, 50*time.Millisecond)
+	defer cancel()
+
+	client := New(ts.URL, "", false)
+	client.Retry = &RetryPolicy{InitialInterval: time.Hour}
+	_, err := client.Detail(ctx, &drone.Stage{ID: 1})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Want deadline exceeded error, got %v", err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"-1", 0},
+		{"invalid", 0},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+	}
+	for _, test := range tests {
+		res := &http.Response{Header: http.Header{}}
+		res.Header.Set("Retry-After", test.header)
+		if got := retryAfter(res); got != test.want {
+			t.Errorf("Want Retry-After %q interval %s, got %s", test.header, test.want, got)
+		}
+	}
+}
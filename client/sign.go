@@ -0,0 +1,181 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request signature headers.
+const (
+	HeaderTimestamp = "X-Drone-Timestamp"
+	HeaderNonce     = "X-Drone-Nonce"
+	HeaderSignature = "X-Drone-Signature"
+)
+
+// signature algorithm prefix.
+const signaturePrefix = "hmac-sha256="
+
+// DefaultSignatureWindow is the default window in which a
+// signed request is considered valid.
+const DefaultSignatureWindow = 5 * time.Minute
+
+// Request signature errors.
+var (
+	ErrSignatureMissing = errors.New("Signature Missing")
+	ErrSignatureInvalid = errors.New("Signature Invalid")
+	ErrSignatureExpired = errors.New("Signature Expired")
+	ErrSignatureReplay  = errors.New("Signature Replayed")
+)
+
+// SignRequest signs the http.Request with the shared secret.
+// The signature is an hmac-sha256 of the request method,
+// path, timestamp, nonce and body digest, which allows the
+// server to authenticate the request without the secret
+// being sent over the wire.
+func SignRequest(req *http.Request, body []byte, secret string) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, hex.EncodeToString(nonce))
+	req.Header.Set(HeaderSignature, signaturePrefix+
+		signature(req, body, secret))
+}
+
+// VerifyRequest verifies the http.Request signature and
+// returns an error if the signature is missing, invalid,
+// or the request timestamp is outside the window. The
+// request body is read and replaced so that it can be
+// read by the caller.
+func VerifyRequest(req *http.Request, secret string, window time.Duration) error {
+	header := req.Header.Get(HeaderSignature)
+	if header == "" {
+		return ErrSignatureMissing
+	}
+	if !strings.HasPrefix(header, signaturePrefix) {
+		return ErrSignatureInvalid
+	}
+	timestamp, err := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	if window <= 0 {
+		window = DefaultSignatureWindow
+	}
+	if d := time.Since(time.Unix(timestamp, 0)); d > window || d < -window {
+		return ErrSignatureExpired
+	}
+
+	var body []byte
+	if req.Body != nil {
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	got, err := hex.DecodeString(strings.TrimPrefix(header, signaturePrefix))
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	want, _ := hex.DecodeString(signature(req, body, secret))
+	if !hmac.Equal(got, want) {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
+
+// Verifier is http middleware that verifies signed requests
+// and rejects requests that are unsigned, invalid, expired
+// or replayed. It can be used by test servers to verify
+// requests from the HTTPClient.
+type Verifier struct {
+	Secret string
+
+	// Window is the window in which a signed request is
+	// considered valid. If zero, DefaultSignatureWindow is
+	// used.
+	Window time.Duration
+
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+// Handler returns an http.Handler that verifies the request
+// signature before invoking the next handler.
+func (v *Verifier) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := VerifyRequest(r, v.Secret, v.Window)
+		if err == nil && !v.remember(r.Header.Get(HeaderNonce)) {
+			err = ErrSignatureReplay
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// remember records the nonce and returns false if the nonce
+// was already used within the window.
+func (v *Verifier) remember(nonce string) bool {
+	if nonce == "" {
+		return false
+	}
+	window := v.Window
+	if window <= 0 {
+		window = DefaultSignatureWindow
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.nonces == nil {
+		v.nonces = map[string]time.Time{}
+	}
+	now := time.Now()
+	for k, expires := range v.nonces {
+		if now.After(expires) {
+			delete(v.nonces, k)
+		}
+	}
+	if _, ok := v.nonces[nonce]; ok {
+		return false
+	}
+	// the nonce must be remembered for twice the window
+	// since the timestamp is valid up to the window in
+	// either direction.
+	v.nonces[nonce] = now.Add(2 * window)
+	return true
+}
+
+// helper function returns the hex encoded hmac-sha256
+// signature of the request.
+func signature(req *http.Request, body []byte, secret string) string {
+	digest := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{
+		req.Method,
+		req.URL.RequestURI(),
+		req.Header.Get(HeaderTimestamp),
+		req.Header.Get(HeaderNonce),
+		hex.EncodeToString(digest[:]),
+	}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
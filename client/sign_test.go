@@ -0,0 +1,110 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSignRequest(t *testing.T) {
+	body := []byte(`{"kind":"pipeline"}`)
+	req := httptest.NewRequest("POST", "/rpc/v2/stage?machine=foo", bytes.NewReader(body))
+	SignRequest(req, body, "correct-horse-battery-staple")
+
+	if err := VerifyRequest(req, "correct-horse-battery-staple", 0); err != nil {
+		t.Error(err)
+	}
+	if b, _ := ioutil.ReadAll(req.Body); !bytes.Equal(b, body) {
+		t.Errorf("Expect request body restored after verification")
+	}
+	if err := VerifyRequest(req, "incorrect", 0); err != ErrSignatureInvalid {
+		t.Errorf("Want invalid signature error, got %v", err)
+	}
+}
+
+func TestVerifyRequest_Tampered(t *testing.T) {
+	body := []byte(`{"kind":"pipeline"}`)
+	req := httptest.NewRequest("POST", "/rpc/v2/stage", bytes.NewReader([]byte(`{"kind":"secret"}`)))
+	SignRequest(req, body, "secret")
+	if err := VerifyRequest(req, "secret", 0); err != ErrSignatureInvalid {
+		t.Errorf("Want invalid signature error for tampered body, got %v", err)
+	}
+
+	req = httptest.NewRequest("POST", "/rpc/v2/stage", bytes.NewReader(body))
+	SignRequest(req, body, "secret")
+	req.URL.Path = "/rpc/v2/step"
+	if err := VerifyRequest(req, "secret", 0); err != ErrSignatureInvalid {
+		t.Errorf("Want invalid signature error for tampered path, got %v", err)
+	}
+}
+
+func TestVerifyRequest_Expired(t *testing.T) {
+	req := httptest.NewRequest("POST", "/rpc/v2/stage", nil)
+	SignRequest(req, nil, "secret")
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10))
+	if err := VerifyRequest(req, "secret", time.Minute); err != ErrSignatureExpired {
+		t.Errorf("Want expired signature error, got %v", err)
+	}
+}
+
+func TestVerifyRequest_Missing(t *testing.T) {
+	req := httptest.NewRequest("POST", "/rpc/v2/stage", nil)
+	req.Header.Set("X-Drone-Token", "secret")
+	if err := VerifyRequest(req, "secret", 0); err != ErrSignatureMissing {
+		t.Errorf("Want missing signature error, got %v", err)
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	verifier := &Verifier{Secret: "secret"}
+	ts := httptest.NewServer(verifier.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Drone-Token") != "" {
+			t.Errorf("Expect secret not sent with signed request")
+		}
+		w.Write([]byte(`{"id":1}`))
+	})))
+	defer ts.Close()
+
+	client := New(ts.URL, "secret", false)
+	client.Sign = true
+	stage, err := client.Request(noContext, &Filter{Kind: "pipeline"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := stage.ID, int64(1); got != want {
+		t.Errorf("Want stage id %d, got %d", want, got)
+	}
+
+	client.Secret = "incorrect"
+	if err := client.Ping(noContext, ""); err == nil {
+		t.Errorf("Expect unauthorized error")
+	}
+}
+
+func TestVerifier_Replay(t *testing.T) {
+	verifier := &Verifier{Secret: "secret"}
+	handler := verifier.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("POST", "/rpc/v2/ping", nil)
+	SignRequest(req, nil, "secret")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got, want := w.Code, 200; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got, want := w.Code, 401; got != want {
+		t.Errorf("Want replayed request status code %d, got %d", want, got)
+	}
+}
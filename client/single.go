@@ -50,3 +50,13 @@ func (t *SingleFlight) Request(ctx context.Context, args *Filter) (*drone.Stage,
 	t.mu.Lock()
 	return t.Client.Request(ctx, args)
 }
+
+// Heartbeat reports the runner status to the server. If the
+// client cannot report the runner status, a ping message is
+// sent instead.
+func (t *SingleFlight) Heartbeat(ctx context.Context, node *Node) error {
+	if c, ok := t.Client.(Heartbeater); ok {
+		return c.Heartbeat(ctx, node)
+	}
+	return t.Client.Ping(ctx, node.Machine)
+}
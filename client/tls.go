@@ -0,0 +1,245 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/drone/runner-go/logger"
+)
+
+// TLSConfig configures TLS for connections to the server.
+type TLSConfig struct {
+	// CAFile is the path to a PEM encoded certificate
+	// authority bundle. If set, only the certificate
+	// authorities in the bundle are trusted.
+	CAFile string
+
+	// CertFile and KeyFile are the paths to the PEM encoded
+	// client certificate and private key used for mutual
+	// TLS authentication with the server.
+	CertFile string
+	KeyFile  string
+
+	// MinVersion is the minimum TLS version. If zero, TLS
+	// 1.2 is the minimum version.
+	MinVersion uint16
+
+	// ServerName overrides the server name used to verify
+	// the server certificate.
+	ServerName string
+
+	// SkipVerify disables verification of the server
+	// certificate. It must be explicitly enabled and is
+	// never used as a fallback.
+	SkipVerify bool
+
+	// ReloadInterval is the interval at which the
+	// certificate files are checked for changes. If the
+	// files change, the certificates are reloaded without
+	// restarting the runner. If zero, the certificates are
+	// never reloaded.
+	ReloadInterval time.Duration
+
+	Logger logger.Logger
+}
+
+// NewTLS returns a new runner client that connects to the
+// server using the TLS configuration.
+func NewTLS(endpoint, secret string, config *TLSConfig) (*HTTPClient, error) {
+	transport, err := newTLSTransport(config)
+	if err != nil {
+		return nil, err
+	}
+	return &HTTPClient{
+		Endpoint:   endpoint,
+		Secret:     secret,
+		SkipVerify: config.SkipVerify,
+		Client: &http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+			Transport: transport,
+		},
+	}, nil
+}
+
+// Load returns the tls.Config. An error is returned if the
+// certificate files cannot be loaded.
+func (c *TLSConfig) Load() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         c.MinVersion,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.SkipVerify,
+	}
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls: no certificates found in %s", c.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("tls: client certificate and key must both be provided")
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// ParseTLSVersion parses the TLS version string (e.g. 1.2)
+// and returns the version number.
+func ParseTLSVersion(s string) (uint16, error) {
+	switch s {
+	case "":
+		return 0, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("tls: unsupported version %q", s)
+}
+
+// files returns the certificate files.
+func (c *TLSConfig) files() []string {
+	var out []string
+	for _, file := range []string{c.CAFile, c.CertFile, c.KeyFile} {
+		if file != "" {
+			out = append(out, file)
+		}
+	}
+	return out
+}
+
+// tlsTransport is an http.RoundTripper that reloads the
+// TLS configuration when the certificate files change.
+type tlsTransport struct {
+	config *TLSConfig
+
+	sync.Mutex
+	transport *http.Transport
+	modified  map[string]time.Time
+	checked   time.Time
+}
+
+func newTLSTransport(config *TLSConfig) (*tlsTransport, error) {
+	t := &tlsTransport{config: config}
+	modified := t.stat()
+	transport, err := t.load()
+	if err != nil {
+		return nil, err
+	}
+	t.transport = transport
+	t.modified = modified
+	t.checked = time.Now()
+	return t, nil
+}
+
+// RoundTrip executes a single HTTP transaction.
+func (t *tlsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.current().RoundTrip(req)
+}
+
+// current returns the current transport, reloading the
+// transport if the certificate files changed.
+func (t *tlsTransport) current() *http.Transport {
+	t.Lock()
+	defer t.Unlock()
+	interval := t.config.ReloadInterval
+	if interval <= 0 || time.Since(t.checked) < interval {
+		return t.transport
+	}
+	t.checked = time.Now()
+
+	modified := t.stat()
+	if !changed(t.modified, modified) {
+		return t.transport
+	}
+	transport, err := t.load()
+	if err != nil {
+		// if the updated certificates are invalid, for
+		// example because the files are partially written,
+		// we continue using the previous certificates and
+		// retry on the next check.
+		t.logger().WithError(err).
+			Warnln("tls: cannot reload certificates")
+		return t.transport
+	}
+	t.logger().Infoln("tls: certificates reloaded")
+	t.transport.CloseIdleConnections()
+	t.transport = transport
+	t.modified = modified
+	return t.transport
+}
+
+// load returns a new transport with the TLS configuration.
+func (t *tlsTransport) load() (*http.Transport, error) {
+	config, err := t.config.Load()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: config,
+	}, nil
+}
+
+// stat returns the modification time of each certificate
+// file.
+func (t *tlsTransport) stat() map[string]time.Time {
+	out := map[string]time.Time{}
+	for _, file := range t.config.files() {
+		if info, err := os.Stat(file); err == nil {
+			out[file] = info.ModTime()
+		}
+	}
+	return out
+}
+
+func (t *tlsTransport) logger() logger.Logger {
+	if t.config.Logger == nil {
+		return logger.Discard()
+	}
+	return t.config.Logger
+}
+
+// helper function returns true if the file modification
+// times changed.
+func changed(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return true
+	}
+	for k, v := range a {
+		if !v.Equal(b[k]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,248 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, nil, "ca")
+	server := newTestCert(t, ca, "server")
+	client := newTestCert(t, ca, "client")
+	ca.write(t, dir)
+	client.write(t, dir)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{server.pair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool(),
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	c, err := NewTLS(ts.URL, "", &TLSConfig{
+		CAFile:   filepath.Join(dir, "ca.pem"),
+		CertFile: filepath.Join(dir, "client.pem"),
+		KeyFile:  filepath.Join(dir, "client-key.pem"),
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := c.Ping(noContext, ""); err != nil {
+		t.Errorf("Expect mutual tls connection, got %s", err)
+	}
+
+	// the connection must fail if the client does not
+	// provide a certificate.
+	c, _ = NewTLS(ts.URL, "", &TLSConfig{
+		CAFile: filepath.Join(dir, "ca.pem"),
+	})
+	if err := c.Ping(noContext, ""); err == nil {
+		t.Errorf("Expect connection error without client certificate")
+	}
+
+	// the connection must fail if the server certificate
+	// is not signed by the certificate authority.
+	c, _ = NewTLS(ts.URL, "", &TLSConfig{
+		CertFile: filepath.Join(dir, "client.pem"),
+		KeyFile:  filepath.Join(dir, "client-key.pem"),
+	})
+	if err := c.Ping(noContext, ""); err == nil {
+		t.Errorf("Expect certificate verification error")
+	}
+}
+
+func TestTLS_Reload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	ca1 := newTestCert(t, nil, "ca")
+	ca2 := newTestCert(t, nil, "ca")
+	server := newTestCert(t, ca2, "server")
+	ca1.write(t, dir)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{server.pair}}
+	ts.StartTLS()
+	defer ts.Close()
+
+	c, err := NewTLS(ts.URL, "", &TLSConfig{
+		CAFile:         filepath.Join(dir, "ca.pem"),
+		ReloadInterval: time.Millisecond,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := c.Ping(noContext, ""); err == nil {
+		t.Errorf("Expect certificate verification error")
+	}
+
+	// replace the certificate authority bundle and ensure
+	// the modification time changes.
+	ca2.write(t, dir)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "ca.pem"), future, future)
+	time.Sleep(2 * time.Millisecond)
+
+	if err := c.Ping(noContext, ""); err != nil {
+		t.Errorf("Expect certificates reloaded, got %s", err)
+	}
+}
+
+func TestTLSConfig_Error(t *testing.T) {
+	tests := []*TLSConfig{
+		{CAFile: "/path/to/nonexistent/ca.pem"},
+		{CertFile: "/path/to/cert.pem"},
+		{KeyFile: "/path/to/key.pem"},
+	}
+	for _, test := range tests {
+		if _, err := NewTLS("https://localhost", "", test); err == nil {
+			t.Errorf("Expect error loading tls configuration %+v", test)
+		}
+	}
+
+	file, _ := ioutil.TempFile("", "drone")
+	file.WriteString("invalid")
+	file.Close()
+	defer os.Remove(file.Name())
+	if _, err := (&TLSConfig{CAFile: file.Name()}).Load(); err == nil {
+		t.Errorf("Expect error loading invalid certificate authority")
+	}
+}
+
+func TestTLSConfig_MinVersion(t *testing.T) {
+	config, err := new(TLSConfig).Load()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := config.MinVersion, uint16(tls.VersionTLS12); got != want {
+		t.Errorf("Want default min version %d, got %d", want, got)
+	}
+	if config.InsecureSkipVerify {
+		t.Errorf("Expect certificate verification enabled")
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	tests := []struct {
+		s    string
+		want uint16
+		err  bool
+	}{
+		{"", 0, false},
+		{"1.2", tls.VersionTLS12, false},
+		{"1.3", tls.VersionTLS13, false},
+		{"2.0", 0, true},
+	}
+	for _, test := range tests {
+		got, err := ParseTLSVersion(test.s)
+		if got != test.want || (err != nil) != test.err {
+			t.Errorf("Want version %q parsed as %d, got %d", test.s, test.want, got)
+		}
+	}
+}
+
+// testCert is a certificate and private key generated for
+// testing purposes.
+type testCert struct {
+	name string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pair tls.Certificate
+	der  []byte
+}
+
+// helper function generates a certificate signed by the
+// parent certificate, or a self-signed certificate
+// authority if the parent is nil.
+func newTestCert(t *testing.T, parent *testCert, name string) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{
+		name: name,
+		cert: cert,
+		key:  key,
+		der:  der,
+		pair: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+	}
+}
+
+func (c *testCert) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.cert)
+	return pool
+}
+
+// helper function writes the pem encoded certificate and
+// private key to the directory.
+func (c *testCert) write(t *testing.T, dir string) {
+	b, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der})
+	key := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b})
+	ioutil.WriteFile(filepath.Join(dir, c.name+".pem"), cert, 0600)
+	ioutil.WriteFile(filepath.Join(dir, c.name+"-key.pem"), key, 0600)
+}
@@ -7,30 +7,112 @@
 package handler
 
 import (
+	"encoding/json"
 	"net/http"
+	"net/url"
 	"sort"
 	"strconv"
 
 	"github.com/drone/drone-go/drone"
 	hook "github.com/drone/runner-go/logger/history"
+	"github.com/drone/runner-go/pipeline"
 	"github.com/drone/runner-go/pipeline/reporter/history"
 )
 
+// HealthCheck returns the status of a runner component, and
+// an error if the component is unhealthy.
+type HealthCheck func() (string, error)
+
+// Drainer is implemented by a poller that can be drained.
+type Drainer interface {
+	// Drain stops the poller from requesting new stages.
+	Drain()
+
+	// Draining returns true if the poller is draining.
+	Draining() bool
+}
+
+// Pauser is implemented by a poller that can be paused.
+type Pauser interface {
+	// Pause stops the poller from requesting new stages
+	// until the poller is resumed.
+	Pause()
+
+	// Resume resumes requesting new stages.
+	Resume()
+
+	// Paused returns true if the poller is paused.
+	Paused() bool
+}
+
+// Checker is implemented by a poller that reports its
+// status as a health check.
+type Checker interface {
+	// Check returns the poller status.
+	Check() (string, error)
+}
+
+// PollerState provides the poller state.
+type PollerState struct {
+	Paused   bool `json:"paused"`
+	Draining bool `json:"draining"`
+}
+
+// Health provides the status of a runner component.
+type Health struct {
+	Status  string `json:"status"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
 // HandleHealth returns a http.HandlerFunc that returns a 200
 // if the service is healthly.
 func HandleHealth(t *history.History) http.HandlerFunc {
+	return HandleHealthCheck(t, nil)
+}
+
+// HandleHealthCheck returns a http.HandlerFunc that returns a
+// 200 if the service and all named components are healthy,
+// and a 503 if any component is unhealthy. The status of each
+// component is written to the response body.
+func HandleHealthCheck(t *history.History, checks map[string]HealthCheck) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// TODO(bradrydzewski) iterate through the list of
 		// pending or running stages and write an error message
 		// if the timeout is exceeded.
 		nocache(w)
-		w.WriteHeader(200)
+		if len(checks) == 0 {
+			w.WriteHeader(200)
+			return
+		}
+		code := 200
+		out := map[string]*Health{}
+		for name, check := range checks {
+			status, err := check()
+			health := &Health{Status: status, Healthy: err == nil}
+			if err != nil {
+				health.Error = err.Error()
+				code = 503
+			}
+			out[name] = health
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(out)
 	}
 }
 
 // HandleIndex returns a http.HandlerFunc that displays a list
 // of currently and previously executed builds.
 func HandleIndex(t *history.History) http.HandlerFunc {
+	return HandleDashboard(t, nil, nil)
+}
+
+// HandleDashboard returns a http.HandlerFunc that displays a
+// list of currently and previously executed builds, and the
+// poller state. If the drainer or pauser is nil, the
+// corresponding poller state and controls are not displayed.
+func HandleDashboard(t *history.History, drainer Drainer, pauser Pauser) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		d := t.Entries()
 
@@ -44,8 +126,37 @@ func HandleIndex(t *history.History) http.HandlerFunc {
 			renderJSON(w, d)
 		} else {
 			nocache(w)
-			render(w, "index.tmpl", &data{Items: d})
+			render(w, "index.tmpl", &data{
+				Items:    d,
+				Drain:    drainer != nil,
+				Draining: drainer != nil && drainer.Draining(),
+				Pause:    pauser != nil,
+				Paused:   pauser != nil && pauser.Paused(),
+			})
+		}
+	}
+}
+
+// HandleDrain returns a http.HandlerFunc that drains the
+// poller and redirects to the dashboard.
+func HandleDrain(d Drainer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !sameOrigin(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		d.Drain()
+		if r.Header.Get("Accept") == "application/json" {
+			nocache(w)
+			renderJSON(w, map[string]bool{"draining": d.Draining()})
+			return
 		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
 	}
 }
 
@@ -54,6 +165,7 @@ func HandleIndex(t *history.History) http.HandlerFunc {
 func HandleStage(hist *history.History, logger *hook.Hook) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id, _ := strconv.ParseInt(r.FormValue("id"), 10, 64)
+		stream := pipeline.Stream(r.FormValue("stream"))
 
 		// filter logs by stage id.
 		logs := logger.Filter(func(entry *hook.Entry) bool {
@@ -70,14 +182,100 @@ func HandleStage(hist *history.History, logger *hook.Hook) http.HandlerFunc {
 		nocache(w)
 		render(w, "stage.tmpl", struct {
 			*history.Entry
-			Logs []*hook.Entry
+			Logs   []*hook.Entry
+			Output []*history.Line
+			Stream pipeline.Stream
 		}{
-			Entry: entry,
-			Logs:  logs,
+			Entry:  entry,
+			Logs:   logs,
+			Output: entry.Filter(stream),
+			Stream: stream,
 		})
 	}
 }
 
+// HandlePause returns a http.HandlerFunc that pauses the
+// poller and redirects to the dashboard.
+func HandlePause(p Pauser) http.HandlerFunc {
+	return handleControl(func() PollerState {
+		p.Pause()
+		return PollerState{Paused: p.Paused()}
+	})
+}
+
+// HandleResume returns a http.HandlerFunc that resumes the
+// poller and redirects to the dashboard.
+func HandleResume(p Pauser) http.HandlerFunc {
+	return handleControl(func() PollerState {
+		p.Resume()
+		return PollerState{Paused: p.Paused()}
+	})
+}
+
+// HandlePoller returns a http.HandlerFunc that writes the
+// poller state in json format. If the drainer or pauser is
+// nil, the corresponding state is omitted.
+func HandlePoller(d Drainer, p Pauser) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		nocache(w)
+		renderJSON(w, pollerState(d, p))
+	}
+}
+
+// handleControl returns a http.HandlerFunc that invokes the
+// control function for POST requests, and writes the poller
+// state in json format or redirects to the dashboard.
+func handleControl(fn func() PollerState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !sameOrigin(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		state := fn()
+		if r.Header.Get("Accept") == "application/json" {
+			nocache(w)
+			renderJSON(w, state)
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// helper function returns false if the request is sent by a
+// browser from a different origin, which prevents a page on
+// another site from changing the poller state with the
+// credentials cached by the browser. Requests without an
+// Origin or Referer header, which are not sent by a browser
+// form, are permitted.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// helper function returns the poller state.
+func pollerState(d Drainer, p Pauser) PollerState {
+	var state PollerState
+	if d != nil {
+		state.Draining = d.Draining()
+	}
+	if p != nil {
+		state.Paused = p.Paused()
+	}
+	return state
+}
+
 // HandleLogHistory returns a http.HandlerFunc that displays a
 // list recent log entries.
 func HandleLogHistory(t *hook.Hook) http.HandlerFunc {
@@ -93,6 +291,16 @@ func HandleLogHistory(t *hook.Hook) http.HandlerFunc {
 // functions for calculating the system state.
 type data struct {
 	Items []*history.Entry
+
+	// Drain is true if the poller can be drained, and
+	// Draining is true if the poller is draining.
+	Drain    bool
+	Draining bool
+
+	// Pause is true if the poller can be paused, and
+	// Paused is true if the poller is paused.
+	Pause  bool
+	Paused bool
 }
 
 // helper function returns true if no running builds exists.
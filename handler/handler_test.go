@@ -3,3 +3,184 @@
 // that can be found in the LICENSE file.
 
 package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+	hook "github.com/drone/runner-go/logger/history"
+	"github.com/drone/runner-go/pipeline"
+	"github.com/drone/runner-go/pipeline/reporter/history"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHandleHealth(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/healthz", nil)
+	HandleHealth(nil)(w, r)
+	if got, want := w.Code, 200; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+}
+
+func TestHandleHealthCheck(t *testing.T) {
+	checks := map[string]HealthCheck{
+		"client": func() (string, error) {
+			return "open", errors.New("Circuit Breaker Open")
+		},
+		"poller": func() (string, error) {
+			return "running", nil
+		},
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/healthz", nil)
+	HandleHealthCheck(nil, checks)(w, r)
+	if got, want := w.Code, 503; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+
+	got := map[string]*Health{}
+	json.NewDecoder(w.Body).Decode(&got)
+	want := map[string]*Health{
+		"client": {Status: "open", Error: "Circuit Breaker Open"},
+		"poller": {Status: "running", Healthy: true},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected health response")
+		t.Log(diff)
+	}
+}
+
+func TestHandleDrain(t *testing.T) {
+	drainer := new(mockDrainer)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/drain", nil)
+	HandleDrain(drainer)(w, r)
+	if got, want := w.Code, 405; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+	if drainer.draining {
+		t.Errorf("Expect poller not drained with GET request")
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/drain", nil)
+	HandleDrain(drainer)(w, r)
+	if got, want := w.Code, 303; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+	if !drainer.draining {
+		t.Errorf("Expect poller drained")
+	}
+}
+
+func TestHandleDashboard_Draining(t *testing.T) {
+	drainer := &mockDrainer{draining: true}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	HandleDashboard(history.New(nil), drainer, nil)(w, r)
+	if got, want := w.Code, 200; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+	if !strings.Contains(w.Body.String(), "This runner is draining") {
+		t.Errorf("Expect dashboard displays draining state")
+	}
+}
+
+func TestHandlePause(t *testing.T) {
+	pauser := new(mockPauser)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/pause", nil)
+	r.Header.Set("Accept", "application/json")
+	HandlePause(pauser)(w, r)
+	if got, want := w.Code, 200; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+	state := new(PollerState)
+	json.NewDecoder(w.Body).Decode(state)
+	if !state.Paused || !pauser.paused {
+		t.Errorf("Expect poller paused")
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/resume", nil)
+	HandleResume(pauser)(w, r)
+	if got, want := w.Code, 303; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+	if pauser.paused {
+		t.Errorf("Expect poller resumed")
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/pause", nil)
+	HandlePause(pauser)(w, r)
+	if got, want := w.Code, 405; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+	if pauser.paused {
+		t.Errorf("Expect poller not paused with GET request")
+	}
+}
+
+func TestHandleDashboard_Paused(t *testing.T) {
+	pauser := &mockPauser{paused: true}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	HandleDashboard(history.New(nil), nil, pauser)(w, r)
+	body := w.Body.String()
+	if !strings.Contains(body, "This runner is paused") {
+		t.Errorf("Expect dashboard displays paused state")
+	}
+	if !strings.Contains(body, `action="/resume"`) {
+		t.Errorf("Expect dashboard displays resume button")
+	}
+}
+
+func TestHandleStage_Stream(t *testing.T) {
+	state := &pipeline.State{
+		Repo:  &drone.Repo{ID: 1},
+		Build: &drone.Build{ID: 2},
+		Stage: &drone.Stage{ID: 3},
+	}
+	hist := history.New(pipeline.NopReporter())
+	hist.ReportStage(nil, state)
+	w := hist.Stream(nil, state, "clone")
+	w.Write([]byte("hello world"))
+	pipeline.WriteStream(w, pipeline.Stderr, []byte("fatal error"))
+
+	rw := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/view?id=3&stream=stderr", nil)
+	HandleStage(hist, hook.New())(rw, r)
+	if got, want := rw.Code, 200; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+	body := rw.Body.String()
+	if !strings.Contains(body, "fatal error") {
+		t.Errorf("Expect stderr output displayed")
+	}
+	if strings.Contains(body, "hello world") {
+		t.Errorf("Expect stdout output filtered")
+	}
+}
+
+type mockPauser struct {
+	paused bool
+}
+
+func (m *mockPauser) Pause()       { m.paused = true }
+func (m *mockPauser) Resume()      { m.paused = false }
+func (m *mockPauser) Paused() bool { return m.paused }
+
+type mockDrainer struct {
+	draining bool
+}
+
+func (m *mockDrainer) Drain()         { m.draining = true }
+func (m *mockDrainer) Draining() bool { return m.draining }
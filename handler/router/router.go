@@ -20,12 +20,28 @@ type Config struct {
 	Username string
 	Password string
 	Realm    string
+
+	// Health provides named health checks that are
+	// reported by the health endpoint.
+	Health map[string]handler.HealthCheck
+
+	// Drainer provides the poller, which can be drained
+	// from the dashboard. If the poller implements
+	// handler.Checker, the poller state is reported by the
+	// health endpoint.
+	Drainer handler.Drainer
+
+	// Pauser provides the poller, which can be paused and
+	// resumed from the dashboard. If the poller implements
+	// handler.Checker, the poller state is reported by the
+	// health endpoint.
+	Pauser handler.Pauser
 }
 
 // New returns a new route handler.
 func New(tracer *history.History, history *hook.Hook, config Config) http.Handler {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/healthz", handler.HandleHealth(tracer))
+	mux.HandleFunc("/healthz", handler.HandleHealthCheck(tracer, healthChecks(config)))
 
 	// omit dashboard handlers when no password configured.
 	if config.Password == "" {
@@ -44,6 +60,46 @@ func New(tracer *history.History, history *hook.Hook, config Config) http.Handle
 	mux.Handle("/static/", http.StripPrefix("/static/", fs))
 	mux.Handle("/logs", auth(handler.HandleLogHistory(history)))
 	mux.Handle("/view", auth(handler.HandleStage(tracer, history)))
-	mux.Handle("/", auth(handler.HandleIndex(tracer)))
+	mux.Handle("/", auth(handler.HandleDashboard(tracer, config.Drainer, config.Pauser)))
+	if config.Drainer != nil {
+		mux.Handle("/drain", auth(handler.HandleDrain(config.Drainer)))
+	}
+	if config.Pauser != nil {
+		mux.Handle("/pause", auth(handler.HandlePause(config.Pauser)))
+		mux.Handle("/resume", auth(handler.HandleResume(config.Pauser)))
+	}
+	if config.Drainer != nil || config.Pauser != nil {
+		mux.Handle("/poller", auth(handler.HandlePoller(config.Drainer, config.Pauser)))
+	}
 	return mux
 }
+
+// helper function returns the health checks, including the
+// poller health check if the drainer or pauser reports its
+// status as a health check.
+func healthChecks(config Config) map[string]handler.HealthCheck {
+	check := pollerCheck(config.Drainer, config.Pauser)
+	if check == nil {
+		return config.Health
+	}
+	checks := map[string]handler.HealthCheck{}
+	for name, check := range config.Health {
+		checks[name] = check
+	}
+	if _, ok := checks["poller"]; !ok {
+		checks["poller"] = check
+	}
+	return checks
+}
+
+// helper function returns the poller health check, or nil
+// if the poller does not report its status.
+func pollerCheck(drainer handler.Drainer, pauser handler.Pauser) handler.HealthCheck {
+	if c, ok := drainer.(handler.Checker); ok {
+		return c.Check
+	}
+	if c, ok := pauser.(handler.Checker); ok {
+		return c.Check
+	}
+	return nil
+}
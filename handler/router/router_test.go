@@ -3,3 +3,147 @@
 // that can be found in the LICENSE file.
 
 package router
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/drone/runner-go/handler"
+)
+
+func TestHealthz_Drainer(t *testing.T) {
+	drainer := new(mockDrainer)
+	mux := New(nil, nil, Config{Drainer: drainer})
+
+	drainer.draining = true
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/healthz", nil)
+	mux.ServeHTTP(w, r)
+	if got, want := w.Code, 200; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+	got := map[string]*handler.Health{}
+	json.NewDecoder(w.Body).Decode(&got)
+	if health := got["poller"]; health == nil || health.Status != "draining" {
+		t.Errorf("Want health endpoint reports draining poller, got %+v", health)
+	}
+}
+
+func TestDrain_Unauthorized(t *testing.T) {
+	drainer := new(mockDrainer)
+	mux := New(nil, nil, Config{Username: "admin", Password: "password", Drainer: drainer})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/drain", nil)
+	mux.ServeHTTP(w, r)
+	if got, want := w.Code, 401; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+	if drainer.draining {
+		t.Errorf("Expect poller not drained without authentication")
+	}
+}
+
+func TestHealthz_Pauser(t *testing.T) {
+	pauser := &mockPauser{paused: true}
+	mux := New(nil, nil, Config{Pauser: pauser})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/healthz", nil)
+	mux.ServeHTTP(w, r)
+	got := map[string]*handler.Health{}
+	json.NewDecoder(w.Body).Decode(&got)
+	if health := got["poller"]; health == nil || health.Status != "paused" {
+		t.Errorf("Want health endpoint reports paused poller, got %+v", health)
+	}
+}
+
+func TestPause_Unauthorized(t *testing.T) {
+	pauser := new(mockPauser)
+	mux := New(nil, nil, Config{Username: "admin", Password: "password", Pauser: pauser})
+
+	for _, path := range []string{"/pause", "/resume", "/poller"} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", path, nil)
+		mux.ServeHTTP(w, r)
+		if got, want := w.Code, 401; got != want {
+			t.Errorf("Want status code %d for %s, got %d", want, path, got)
+		}
+	}
+	if pauser.paused {
+		t.Errorf("Expect poller not paused without authentication")
+	}
+}
+
+// this test verifies that a request from a page on another
+// site cannot change the poller state.
+func TestPause_CrossOrigin(t *testing.T) {
+	pauser := new(mockPauser)
+	mux := New(nil, nil, Config{Username: "admin", Password: "password", Pauser: pauser})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/pause", nil)
+	r.Header.Set("Origin", "https://attacker.test")
+	r.SetBasicAuth("admin", "password")
+	mux.ServeHTTP(w, r)
+	if got, want := w.Code, 403; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+	if pauser.paused {
+		t.Errorf("Expect poller not paused by a cross-origin request")
+	}
+}
+
+func TestPause(t *testing.T) {
+	pauser := new(mockPauser)
+	mux := New(nil, nil, Config{Username: "admin", Password: "password", Pauser: pauser})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/pause", nil)
+	r.SetBasicAuth("admin", "password")
+	mux.ServeHTTP(w, r)
+	if got, want := w.Code, 303; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+	if !pauser.paused {
+		t.Errorf("Expect poller paused")
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/poller", nil)
+	r.SetBasicAuth("admin", "password")
+	mux.ServeHTTP(w, r)
+	state := new(handler.PollerState)
+	json.NewDecoder(w.Body).Decode(state)
+	if !state.Paused {
+		t.Errorf("Want poller state reports paused poller")
+	}
+}
+
+type mockPauser struct {
+	paused bool
+}
+
+func (m *mockPauser) Pause()       { m.paused = true }
+func (m *mockPauser) Resume()      { m.paused = false }
+func (m *mockPauser) Paused() bool { return m.paused }
+func (m *mockPauser) Check() (string, error) {
+	if m.paused {
+		return "paused", nil
+	}
+	return "polling", nil
+}
+
+type mockDrainer struct {
+	draining bool
+}
+
+func (m *mockDrainer) Drain()         { m.draining = true }
+func (m *mockDrainer) Draining() bool { return m.draining }
+func (m *mockDrainer) Check() (string, error) {
+	if m.draining {
+		return "draining", nil
+	}
+	return "polling", nil
+}
@@ -228,7 +228,7 @@ var files = map[string]file{
 		data: file11,
 		FileInfo: &fileInfo{
 			name:    "style.css",
-			size:    8564,
+			size:    10444,
 			modTime: time.Unix(1572549830, 0),
 		},
 	},
@@ -1468,6 +1468,45 @@ a.card {
     background-repeat: no-repeat;
 }
 
+.alert.draining,
+.alert.paused {
+    box-shadow: 0 2px 4px 0 rgba(30,55,90,.1);
+    box-sizing: border-box;
+    border: 1px solid rgba(30,55,90,.05);
+    border-radius: 4px;
+    margin-bottom: 10px;
+    padding: 15px 30px;
+    text-align: center;
+    color: #1e375a;
+    background-color: #FFFFFF;
+}
+
+/**
+ * control components
+ */
+
+main section > header {
+    display: flex;
+    align-items: center;
+    justify-content: space-between;
+}
+
+main section > header .controls,
+main section > header form {
+    display: flex;
+}
+
+main section > header button {
+    border: 1px solid rgba(30,55,90,.2);
+    border-radius: 4px;
+    padding: 7px 15px;
+    margin-left: 10px;
+    font-size: 14px;
+    color: #1e375a;
+    background-color: #FFFFFF;
+    cursor: pointer;
+}
+
 /**
  * status component.
  */
@@ -1620,6 +1659,69 @@ a.card {
     margin: 0px 3px;
 }
 
+/*
+ * output components
+ */
+
+.output {
+    box-shadow: 0 2px 4px 0 rgba(30,55,90,.1);
+    box-sizing: border-box;
+    border: 1px solid rgba(30,55,90,.05);
+    border-radius: 4px;
+    background-color: #fff;
+    margin-bottom: 10px;
+    padding-bottom: 10px;
+}
+
+.output .filter {
+    padding: 15px;
+    border-bottom: 1px solid rgba(30,55,90,.05);
+    margin-bottom: 10px;
+}
+
+.output .filter a {
+    color: rgba(30,55,90,.6);
+    font-size: 14px;
+    margin-right: 10px;
+    text-decoration: none;
+}
+
+.output .filter a.active {
+    color: #1e375a;
+    font-weight: bold;
+}
+
+.output .line {
+    display: grid;
+    grid-gap: 10px;
+    grid-template-columns: 100px 40px auto;
+    padding: 0px 15px;
+    font-family: var(--font-mono);
+    font-size: 13px;
+    line-height: 20px;
+}
+
+.output .line .step,
+.output .line .number {
+    color: rgba(30,55,90,.6);
+    overflow: hidden;
+    text-overflow: ellipsis;
+    white-space: nowrap;
+}
+
+.output .line .number {
+    text-align: right;
+}
+
+.output .line .message {
+    white-space: pre-wrap;
+    word-break: break-all;
+}
+
+.output .line.stderr .message {
+    color: #ff4164;
+}
+
 /*
  * animations
  */
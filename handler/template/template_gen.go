@@ -65,8 +65,34 @@ var index = `<!DOCTYPE html>
     <section>
         <header>
             <h1>Dashboard</h1>
+            <div class="controls">
+                {{ if and .Pause .Paused }}
+                <form method="post" action="/resume">
+                    <button type="submit">Resume</button>
+                </form>
+                {{ else if .Pause }}
+                <form method="post" action="/pause">
+                    <button type="submit">Pause</button>
+                </form>
+                {{ end }}
+                {{ if and .Drain (not .Draining) }}
+                <form method="post" action="/drain">
+                    <button type="submit">Drain</button>
+                </form>
+                {{ end }}
+            </div>
         </header>
         <article class="cards stages">
+            {{ if .Draining }}
+            <div class="alert draining">
+                <p>This runner is draining and is not accepting new stages.</p>
+            </div>
+            {{ end }}
+            {{ if and .Paused (not .Draining) }}
+            <div class="alert paused">
+                <p>This runner is paused and is not accepting new stages.</p>
+            </div>
+            {{ end }}
             {{ if not .Items }}
             <div class="alert sleeping">
                 <p>There is no recent activity to display.</p>
@@ -241,6 +267,23 @@ var stage = `<!DOCTYPE html>
         </div>
         {{ end }}
 
+        {{ if .Entry.Logs }}
+        <div class="output">
+            <nav class="filter">
+                <a href="/view?id={{ .Stage.ID }}"{{ if not .Stream }} class="active"{{ end }}>all</a>
+                <a href="/view?id={{ .Stage.ID }}&stream=stdout"{{ if eq .Stream "stdout" }} class="active"{{ end }}>stdout</a>
+                <a href="/view?id={{ .Stage.ID }}&stream=stderr"{{ if eq .Stream "stderr" }} class="active"{{ end }}>stderr</a>
+            </nav>
+            {{ range .Output }}
+            <div class="line {{ .Stream }}">
+                <span class="step">{{ .Step }}</span>
+                <span class="number">{{ .Number }}</span>
+                <span class="message">{{ .Message }}</span>
+            </div>
+            {{ end }}
+        </div>
+        {{ end }}
+
         {{ if .Logs }}
         <div class="logs">
             {{ range .Logs }}
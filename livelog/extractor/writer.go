@@ -4,67 +4,429 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"regexp"
+	"sort"
+
+	"github.com/drone/runner-go/pipeline"
 )
 
 var (
 	prefix       = []byte("\u001B]1338;")
+	reportPrefix = []byte("\u001B]1339;")
 	suffix       = []byte("\u001B]0m")
-	re           = regexp.MustCompilePOSIX("\u001B]1338;((.*?)\u001B]0m)")
 	disableCards = os.Getenv("DRONE_FLAG_ENABLE_CARDS") == "false"
 )
 
+// DefaultCardName is the name of a card that does not
+// specify a name.
+const DefaultCardName = "default"
+
+// DefaultCardLimit is the default maximum size of a decoded
+// card, in bytes.
+const DefaultCardLimit = 1048576
+
+// names are restricted to a safe subset of characters.
+var validName = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// Card is a card extracted from the step output.
+type Card struct {
+	// Name is the card name. A card is named by prefixing
+	// the encoded card with the name and a semicolon.
+	Name string
+
+	// Data is the json-encoded card.
+	Data []byte
+}
+
+// Report is a test report extracted from the step output.
+type Report struct {
+	// Format is the report format. A report format is
+	// specified by prefixing the encoded report with the
+	// format and a semicolon.
+	Format string
+
+	// Data is the raw test report.
+	Data []byte
+}
+
+// ReportError describes why a test report was rejected.
+type ReportError struct {
+	Format string
+	Reason string
+}
+
+func (e *ReportError) Error() string {
+	return fmt.Sprintf("test report %s rejected: %s", e.Format, e.Reason)
+}
+
+// CardError describes why a card was rejected.
+type CardError struct {
+	Name   string
+	Reason string
+}
+
+func (e *CardError) Error() string {
+	return fmt.Sprintf("card %s rejected: %s", e.Name, e.Reason)
+}
+
+// Writer extracts cards and test reports from the step
+// output, and writes the remaining output to the base writer.
+// A card or test report is written to the output as a base64
+// encoded payload wrapped in an ansi escape sequence, and may
+// span multiple writes.
 type Writer struct {
-	base    io.Writer
-	file    []byte
-	chunked bool
+	base  io.Writer
+	limit int
+
+	// card extraction state, by stream.
+	state map[pipeline.Stream]*state
+
+	cards    []*Card
+	reports  []*Report
+	rejected []error
+}
+
+// state tracks the extraction of a card from a stream.
+type state struct {
+	// pending output that may contain a partial prefix or
+	// suffix, and must be buffered until more output is
+	// written.
+	pending []byte
+
+	// payload of the card or test report being extracted,
+	// and whether the payload exceeds the size limit.
+	inside   bool
+	report   bool
+	payload  []byte
+	overflow bool
 }
 
+// New returns a new Writer that extracts cards from the
+// output written to io.Writer w.
 func New(w io.Writer) *Writer {
-	return &Writer{w, nil, false}
+	return &Writer{
+		base:  w,
+		limit: DefaultCardLimit,
+		state: map[pipeline.Stream]*state{},
+	}
+}
+
+// SetLimit sets the maximum size of a decoded card or test
+// report, in bytes. A card or test report that exceeds the
+// limit is rejected.
+func (e *Writer) SetLimit(limit int) {
+	e.limit = limit
 }
 
 func (e *Writer) Write(p []byte) (n int, err error) {
+	return e.write("", p)
+}
+
+// WriteStream writes p from the named stream. Output that
+// does not contain a card is written to the base writer
+// with the stream.
+func (e *Writer) WriteStream(stream pipeline.Stream, p []byte) (n int, err error) {
+	return e.write(stream, p)
+}
+
+// Flush writes the buffered output to the base writer. A card
+// that is not terminated by the ansi suffix is extracted from
+// the buffered payload.
+func (e *Writer) Flush() error {
+	var streams []string
+	for stream := range e.state {
+		streams = append(streams, string(stream))
+	}
+	sort.Strings(streams)
+
+	var result error
+	for _, name := range streams {
+		stream := pipeline.Stream(name)
+		s := e.state[stream]
+		if s.inside {
+			s.collect(s.pending, e.limit)
+			e.finish(s)
+		} else if len(s.pending) != 0 {
+			if _, err := e.emit(stream, s.pending); err != nil && result == nil {
+				result = err
+			}
+		}
+		delete(e.state, stream)
+	}
+	return result
+}
+
+func (e *Writer) write(stream pipeline.Stream, p []byte) (n int, err error) {
 	if disableCards {
-		return e.base.Write(p)
+		return e.emit(stream, p)
 	}
-	if bytes.HasPrefix(p, prefix) == false && e.chunked == false {
-		return e.base.Write(p)
+	s, ok := e.state[stream]
+	if !ok {
+		if !bytes.Contains(p, prefix[:1]) {
+			return e.emit(stream, p)
+		}
+		s = new(state)
+		e.state[stream] = s
 	}
 	n = len(p)
 
-	// if the data does not include the ansi suffix,
-	// it exceeds the size of the buffer and is chunked.
-	e.chunked = !bytes.Contains(p, suffix)
+	data := append(s.pending, p...)
+	s.pending = nil
+	for len(data) != 0 {
+		if s.inside {
+			i := bytes.Index(data, suffix)
+			if i == -1 {
+				// the suffix may be split across writes,
+				// in which case the partial suffix is
+				// buffered.
+				k := overlap(data, suffix)
+				s.collect(data[:len(data)-k], e.limit)
+				s.pending = append([]byte(nil), data[len(data)-k:]...)
+				return n, nil
+			}
+			s.collect(data[:i], e.limit)
+			e.finish(s)
 
-	// trim the ansi prefix and suffix from the data,
-	// and also trim any spacing or newlines that could
-	// cause confusion.
-	p = bytes.TrimSpace(p)
-	p = bytes.TrimPrefix(p, prefix)
-	p = bytes.TrimSuffix(p, suffix)
+			// trim the newline that terminates the card,
+			// which could cause confusion.
+			data = data[i+len(suffix):]
+			data = bytes.TrimPrefix(data, []byte("\r"))
+			data = bytes.TrimPrefix(data, []byte("\n"))
+			continue
+		}
 
-	e.file = append(e.file, p...)
+		i, report := index(data)
+		if i == -1 {
+			// the prefix may be split across writes, in
+			// which case the partial prefix is buffered.
+			k := overlap(data, prefix)
+			if kr := overlap(data, reportPrefix); kr > k {
+				k = kr
+			}
+			if k != len(data) {
+				if _, err := e.emit(stream, data[:len(data)-k]); err != nil {
+					return n, err
+				}
+			}
+			if k == 0 {
+				delete(e.state, stream)
+			} else {
+				s.pending = append([]byte(nil), data[len(data)-k:]...)
+			}
+			return n, nil
+		}
+		if i != 0 {
+			if _, err := e.emit(stream, data[:i]); err != nil {
+				return n, err
+			}
+		}
+		s.inside = true
+		s.report = report
+		data = data[i+len(prefix):]
+	}
 	return n, nil
 }
 
+// emit writes the output to the base writer.
+func (e *Writer) emit(stream pipeline.Stream, p []byte) (int, error) {
+	if stream == "" {
+		return e.base.Write(p)
+	}
+	return pipeline.WriteStream(e.base, stream, p)
+}
+
+// finish validates the extracted card or test report and
+// resets the extraction state.
+func (e *Writer) finish(s *state) {
+	payload, overflow, report := s.payload, s.overflow, s.report
+	s.inside = false
+	s.report = false
+	s.payload = nil
+	s.overflow = false
+
+	if report {
+		e.finishReport(payload, overflow)
+		return
+	}
+
+	name, data, err := parse(payload, overflow, e.limit)
+	if err != nil {
+		e.rejected = append(e.rejected, err)
+		return
+	}
+	for _, card := range e.cards {
+		if card.Name == name {
+			card.Data = data
+			return
+		}
+	}
+	e.cards = append(e.cards, &Card{Name: name, Data: data})
+}
+
+// finishReport decodes the extracted test report.
+func (e *Writer) finishReport(payload []byte, overflow bool) {
+	var format string
+	if i := bytes.IndexByte(payload, ';'); i != -1 {
+		format = string(payload[:i])
+		payload = payload[i+1:]
+	}
+	reject := func(reason string, a ...interface{}) {
+		e.rejected = append(e.rejected, &ReportError{Format: format, Reason: fmt.Sprintf(reason, a...)})
+	}
+
+	switch {
+	case overflow:
+		reject("exceeds the size limit of %d bytes", e.limit)
+		return
+	case format != "" && !validName.MatchString(format):
+		reject("invalid format %q", format)
+		return
+	}
+
+	data, err := base64.StdEncoding.DecodeString(string(payload))
+	switch {
+	case err != nil:
+		reject("invalid base64 encoding: %s", err)
+	case len(data) == 0:
+		reject("empty payload")
+	case len(data) > e.limit:
+		reject("exceeds the size limit of %d bytes", e.limit)
+	default:
+		e.reports = append(e.reports, &Report{Format: format, Data: data})
+	}
+}
+
+// collect appends the encoded payload, ignoring whitespace
+// that separates chunks of the payload.
+func (s *state) collect(p []byte, limit int) {
+	if s.overflow {
+		return
+	}
+	for _, b := range p {
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		s.payload = append(s.payload, b)
+	}
+	// the payload includes the optional name, which is
+	// limited to 64 characters and a separator.
+	if len(s.payload) > base64.StdEncoding.EncodedLen(limit)+65 {
+		s.payload = nil
+		s.overflow = true
+	}
+}
+
+// Cards returns the valid cards extracted from the output,
+// in the order the cards are first written. If a card is
+// written more than once, the last card is returned.
+func (e *Writer) Cards() []*Card {
+	return e.cards
+}
+
+// Reports returns the test reports extracted from the
+// output, in the order the reports are written.
+func (e *Writer) Reports() []*Report {
+	return e.reports
+}
+
+// Rejected returns the errors that describe why invalid
+// cards and test reports were rejected.
+func (e *Writer) Rejected() []error {
+	return e.rejected
+}
+
+// File returns the first card extracted from the output.
 func (e *Writer) File() ([]byte, bool) {
-	if len(e.file) == 0 {
+	if len(e.cards) == 0 {
 		return nil, false
 	}
-	data, err := base64.StdEncoding.DecodeString(string(e.file))
+	return e.cards[0].Data, true
+}
+
+// helper function parses and validates the card payload,
+// and returns the card name and json-encoded card.
+func parse(payload []byte, overflow bool, limit int) (string, []byte, error) {
+	name := DefaultCardName
+	if i := bytes.IndexByte(payload, ';'); i != -1 {
+		name = string(payload[:i])
+		payload = payload[i+1:]
+	}
+	reject := func(format string, a ...interface{}) (string, []byte, error) {
+		return name, nil, &CardError{Name: name, Reason: fmt.Sprintf(format, a...)}
+	}
+
+	switch {
+	case overflow:
+		return reject("exceeds the size limit of %d bytes", limit)
+	case !validName.MatchString(name):
+		return reject("invalid name %q", name)
+	case len(payload) == 0:
+		return reject("empty payload")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(string(payload))
 	if err != nil {
-		return nil, false
+		return reject("invalid base64 encoding: %s", err)
+	}
+	if len(data) > limit {
+		return reject("exceeds the size limit of %d bytes", limit)
 	}
-	if isJSON(data) {
-		return data, true
+	if err := validate(data); err != nil {
+		return reject("%s", err)
 	}
-	return nil, false
+	return name, data, nil
 }
 
-func isJSON(data []byte) bool {
-	var js json.RawMessage
-	return json.Unmarshal(data, &js) == nil
+// helper function validates the card against the card
+// schema, which requires a schema url and a data object.
+func validate(data []byte) error {
+	card := struct {
+		Schema *string          `json:"schema"`
+		Data   *json.RawMessage `json:"data"`
+	}{}
+	if err := json.Unmarshal(data, &card); err != nil {
+		return fmt.Errorf("invalid json: %s", err)
+	}
+	if card.Schema == nil || *card.Schema == "" {
+		return fmt.Errorf("missing schema")
+	}
+	if u, err := url.Parse(*card.Schema); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid schema url %q", *card.Schema)
+	}
+	if card.Data == nil || !bytes.HasPrefix(bytes.TrimSpace(*card.Data), []byte("{")) {
+		return fmt.Errorf("data must be a json object")
+	}
+	return nil
+}
+
+// helper function returns the index of the first card or
+// test report prefix in p, and true if the prefix is a test
+// report prefix.
+func index(p []byte) (int, bool) {
+	i := bytes.Index(p, prefix)
+	j := bytes.Index(p, reportPrefix)
+	if j != -1 && (i == -1 || j < i) {
+		return j, true
+	}
+	return i, false
+}
+
+// helper function returns the length of the longest suffix
+// of p that is a prefix of the delimiter.
+func overlap(p, delim []byte) int {
+	n := len(delim) - 1
+	if n > len(p) {
+		n = len(p)
+	}
+	for ; n > 0; n-- {
+		if bytes.HasSuffix(p, delim[:n]) {
+			return n
+		}
+	}
+	return 0
 }
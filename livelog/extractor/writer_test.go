@@ -0,0 +1,137 @@
+package extractor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+const testCard = `{"schema":"https://drone-plugins.github.io/drone-docker/card.json","data":{"tag":"latest"}}`
+
+func encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func TestWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := New(buf)
+	w.Write([]byte("hello\n"))
+	w.Write([]byte("\u001B]1338;" + encode(testCard) + "\u001B]0m\n"))
+	w.Write([]byte("world\n"))
+	w.Flush()
+
+	if got, want := buf.String(), "hello\nworld\n"; got != want {
+		t.Errorf("Want output %q, got %q", want, got)
+	}
+	file, ok := w.File()
+	if !ok {
+		t.Errorf("Want card extracted")
+	}
+	if got, want := string(file), testCard; got != want {
+		t.Errorf("Want card %s, got %s", want, got)
+	}
+}
+
+// this test verifies that a card is reassembled when the
+// prefix, payload and suffix are split across writes, and
+// the card is surrounded by other output.
+func TestWriter_Chunked(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := New(buf)
+	data := "before \u001B]1338;" + encode(testCard) + "\u001B]0m after"
+	for i := 0; i < len(data); i += 5 {
+		end := i + 5
+		if end > len(data) {
+			end = len(data)
+		}
+		w.Write([]byte(data[i:end]))
+	}
+	w.Flush()
+
+	if got, want := buf.String(), "before  after"; got != want {
+		t.Errorf("Want output %q, got %q", want, got)
+	}
+	if got, want := len(w.Cards()), 1; got != want {
+		t.Errorf("Want %d cards, got %d", want, got)
+	}
+}
+
+func TestWriter_Named(t *testing.T) {
+	w := New(new(bytes.Buffer))
+	w.Write([]byte("\u001B]1338;" + encode(testCard) + "\u001B]0m\n"))
+	w.Write([]byte("\u001B]1338;coverage;" + encode(testCard) + "\u001B]0m\n"))
+	w.Flush()
+
+	cards := w.Cards()
+	if got, want := len(cards), 2; got != want {
+		t.Errorf("Want %d cards, got %d", want, got)
+		return
+	}
+	if got, want := cards[0].Name, DefaultCardName; got != want {
+		t.Errorf("Want card name %q, got %q", want, got)
+	}
+	if got, want := cards[1].Name, "coverage"; got != want {
+		t.Errorf("Want card name %q, got %q", want, got)
+	}
+}
+
+func TestWriter_Rejected(t *testing.T) {
+	tests := []struct {
+		payload string
+		reason  string
+	}{
+		{encode(`{"schema":`), "invalid json"},
+		{encode(`{"data":{}}`), "missing schema"},
+		{encode(`{"schema":"card.json","data":{}}`), "invalid schema url"},
+		{encode(`{"schema":"https://example.com/card.json","data":[]}`), "data must be a json object"},
+		{"!!!", "invalid base64 encoding"},
+		{"../card;" + encode(testCard), "invalid name"},
+		{encode(testCard + strings.Repeat(" ", 1024)), "exceeds the size limit"},
+	}
+	for _, test := range tests {
+		w := New(new(bytes.Buffer))
+		w.SetLimit(512)
+		w.Write([]byte("\u001B]1338;" + test.payload + "\u001B]0m"))
+		w.Flush()
+
+		if len(w.Cards()) != 0 {
+			t.Errorf("Want card %q rejected", test.payload)
+		}
+		rejected := w.Rejected()
+		if len(rejected) != 1 || !strings.Contains(rejected[0].Error(), test.reason) {
+			t.Errorf("Want card rejected with reason %q, got %v", test.reason, rejected)
+		}
+	}
+}
+
+func TestWriter_Report(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := New(buf)
+	w.Write([]byte("\u001B]1339;tap;" + encode("1..1\nok 1\n") + "\u001B]0m\n"))
+	w.Write([]byte("\u001B]1338;" + encode(testCard) + "\u001B]0m\n"))
+	w.Write([]byte("\u001B]1339;" + encode("<testsuite/>") + "\u001B]0m\n"))
+	w.Write([]byte("\u001B]1339;junit;\u001B]0m\n"))
+	w.Flush()
+
+	if got := buf.String(); got != "" {
+		t.Errorf("Want reports removed from output, got %q", got)
+	}
+	reports := w.Reports()
+	if got, want := len(reports), 2; got != want {
+		t.Errorf("Want %d reports, got %d", want, got)
+		return
+	}
+	if got, want := reports[0].Format, "tap"; got != want {
+		t.Errorf("Want report format %q, got %q", want, got)
+	}
+	if got, want := string(reports[1].Data), "<testsuite/>"; got != want {
+		t.Errorf("Want report data %q, got %q", want, got)
+	}
+	if got, want := len(w.Cards()), 1; got != want {
+		t.Errorf("Want %d cards, got %d", want, got)
+	}
+	if got, want := len(w.Rejected()), 1; got != want {
+		t.Errorf("Want empty report rejected")
+	}
+}
@@ -8,6 +8,7 @@ package livelog
 
 import (
 	"context"
+	"fmt"
 	"strings"
 	"sync"
 	"time"
@@ -35,6 +36,16 @@ type Writer struct {
 	pending  []*drone.Line
 	history  []*drone.Line
 
+	spool *Spool
+	file  *spoolFile
+
+	// head and tail retention, in bytes.
+	head      int
+	tail      int
+	tailSize  int
+	tailLines []*drone.Line
+	truncated int
+
 	closed bool
 	close  chan struct{}
 	ready  chan struct{}
@@ -65,19 +76,61 @@ func (b *Writer) SetInterval(interval time.Duration) {
 	b.interval = interval
 }
 
-// Write uploads the live log stream to the server.
+// SetRetention sets the Writer to retain the first head
+// bytes and the last tail bytes of the log, instead of
+// discarding the oldest lines when the log exceeds the limit.
+// The truncated lines are replaced with a marker line in the
+// uploaded log.
+func (b *Writer) SetRetention(head, tail int) {
+	b.head = head
+	b.tail = tail
+}
+
+// Truncated returns the number of lines truncated from the
+// log.
+func (b *Writer) Truncated() int {
+	b.Lock()
+	defer b.Unlock()
+	return b.truncated
+}
+
+// SetSpool sets the Writer spool. Lines are persisted to
+// the spool as they are written, and sending logs to the
+// server is retried with backoff. The spool is removed once
+// the logs are uploaded. If the spool file cannot be
+// created, logs are not spooled.
+func (b *Writer) SetSpool(spool *Spool) {
+	file, err := spool.open(b.id)
+	if err != nil {
+		return
+	}
+	b.spool = spool
+	b.file = file
+}
+
+// Write uploads the live log stream to the server. The
+// Writer does not implement pipeline.StreamWriter, because
+// the server does not record the stream of a line, and the
+// stream tag is discarded by pipeline.WriteStream.
 func (b *Writer) Write(p []byte) (n int, err error) {
+	elapsed := time.Since(b.now)
+
+	var lines []*drone.Line
 	for _, part := range split(p) {
 		line := &drone.Line{
 			Number:    b.num,
 			Message:   part,
-			Timestamp: int64(time.Since(b.now).Seconds()),
+			Timestamp: int64(elapsed.Seconds()),
 		}
 
-		for b.size+len(p) > b.limit {
-			b.stop() // buffer is full, step streaming data
-			b.size -= len(b.history[0].Message)
-			b.history = b.history[1:]
+		if b.retained() {
+			b.retain(line)
+		} else {
+			for b.size+len(p) > b.limit {
+				b.stop() // buffer is full, step streaming data
+				b.size -= len(b.history[0].Message)
+				b.history = b.history[1:]
+			}
 		}
 
 		b.size = b.size + len(part)
@@ -89,9 +142,19 @@ func (b *Writer) Write(p []byte) (n int, err error) {
 			b.Unlock()
 		}
 
-		b.Lock()
-		b.history = append(b.history, line)
-		b.Unlock()
+		if !b.retained() {
+			b.Lock()
+			b.history = append(b.history, line)
+			b.Unlock()
+		}
+
+		lines = append(lines, line)
+	}
+
+	// we intentionally ignore spool errors. the logs are
+	// still streamed and uploaded to the server.
+	if b.file != nil {
+		b.spoolLines(lines)
 	}
 
 	select {
@@ -106,19 +169,129 @@ func (b *Writer) Write(p []byte) (n int, err error) {
 // the server.
 func (b *Writer) Close() error {
 	if b.stop() {
-		b.flush()
+		b.flush(context.Background(), nil)
+	}
+	err := b.upload()
+	if b.file != nil {
+		b.file.close()
+		// the spool is retained if the upload fails, and
+		// the logs are uploaded when the spool is replayed.
+		if err == nil {
+			b.spool.remove(b.id)
+		}
 	}
-	return b.upload()
+	return err
 }
 
-// upload uploads the full log history to the server.
+// upload uploads the full log history to the server. If the
+// writer is spooled, the upload is retried with backoff.
 func (b *Writer) upload() error {
-	return b.client.Upload(
-		context.Background(), b.id, b.history)
+	ctx := context.Background()
+	lines := b.lines()
+	if b.spool == nil {
+		return b.client.Upload(ctx, b.id, lines)
+	}
+	return retry(ctx, b.spool.policy(), func() error {
+		return b.client.Upload(ctx, b.id, lines)
+	})
 }
 
-// flush batch uploads all buffered logs to the server.
-func (b *Writer) flush() error {
+// lines returns the full log history. If lines are truncated
+// from the log, the head and tail of the log are separated
+// by a marker line.
+func (b *Writer) lines() []*drone.Line {
+	b.Lock()
+	defer b.Unlock()
+	if !b.retained() {
+		return b.history
+	}
+	lines := make([]*drone.Line, 0, len(b.history)+len(b.tailLines)+1)
+	lines = append(lines, b.history...)
+	if b.truncated != 0 {
+		number := 0
+		if len(b.history) != 0 {
+			number = b.history[len(b.history)-1].Number + 1
+		}
+		lines = append(lines, &drone.Line{
+			Number:    number,
+			Message:   fmt.Sprintf("[%d lines truncated]\n", b.truncated),
+			Timestamp: int64(time.Since(b.now).Seconds()),
+		})
+	}
+	return append(lines, b.tailLines...)
+}
+
+// spoolLines appends the lines to the spool file. Once the
+// spool file exceeds twice the writer limit, it is compacted
+// to the retained log, which bounds the size of the spool.
+func (b *Writer) spoolLines(lines []*drone.Line) {
+	limit := b.limit
+	if b.retained() {
+		limit = b.head + b.tail
+	}
+	if !b.file.full(limit) {
+		b.file.write(b.header(), lines)
+		return
+	}
+	b.Lock()
+	retained := make([]*drone.Line, 0, len(b.history)+len(b.tailLines))
+	retained = append(retained, b.history...)
+	retained = append(retained, b.tailLines...)
+	b.Unlock()
+	b.file.compact(b.header(), retained)
+}
+
+// header returns the spool header, which records the writer
+// limit and retention.
+func (b *Writer) header() *spoolHeader {
+	b.Lock()
+	defer b.Unlock()
+	return &spoolHeader{
+		Limit:     b.limit,
+		Head:      b.head,
+		Tail:      b.tail,
+		Truncated: b.truncated,
+	}
+}
+
+// retained returns true if the writer retains the head and
+// tail of the log.
+func (b *Writer) retained() bool {
+	return b.head > 0 || b.tail > 0
+}
+
+// retain adds the line to the head of the log if the head
+// is not full, else to the tail of the log, discarding the
+// oldest lines in the tail if the tail is full.
+func (b *Writer) retain(line *drone.Line) {
+	b.Lock()
+	defer b.Unlock()
+	size := len(line.Message)
+	if len(b.tailLines) == 0 && b.truncated == 0 && b.size+size <= b.head {
+		b.history = append(b.history, line)
+		return
+	}
+	for len(b.tailLines) != 0 && b.tailSize+size > b.tail {
+		b.closeLocked() // buffer is full, step streaming data
+		b.tailSize -= len(b.tailLines[0].Message)
+		b.tailLines = b.tailLines[1:]
+		b.truncated++
+	}
+	if size > b.tail {
+		b.closeLocked()
+		b.truncated++
+		return
+	}
+	b.tailSize += size
+	b.tailLines = append(b.tailLines, line)
+}
+
+// flush batch uploads all buffered logs to the server. If
+// a retry policy is provided, the batch upload is retried
+// with backoff until the policy is exhausted or the context
+// is canceled, after which the logs are returned to the
+// buffer and sent with the next batch.
+func (b *Writer) flush(ctx context.Context, policy *client.RetryPolicy) error {
 	b.Lock()
 	lines := b.copy()
 	b.clear()
@@ -126,8 +299,20 @@ func (b *Writer) flush() error {
 	if len(lines) == 0 {
 		return nil
 	}
-	return b.client.Batch(
-		context.Background(), b.id, lines)
+	if policy == nil {
+		return b.client.Batch(
+			context.Background(), b.id, lines)
+	}
+	err := retry(ctx, policy, func() error {
+		return b.client.Batch(
+			context.Background(), b.id, lines)
+	})
+	if err != nil {
+		b.Lock()
+		b.pending = append(lines, b.pending...)
+		b.Unlock()
+	}
+	return err
 }
 
 // copy returns a copy of the buffered lines.
@@ -142,13 +327,20 @@ func (b *Writer) clear() {
 
 func (b *Writer) stop() bool {
 	b.Lock()
+	closed := b.closeLocked()
+	b.Unlock()
+	return closed
+}
+
+// closeLocked stops streaming data. The caller must hold
+// the lock.
+func (b *Writer) closeLocked() bool {
 	var closed bool
 	if b.closed == false {
 		close(b.close)
 		closed = true
 		b.closed = true
 	}
-	b.Unlock()
 	return closed
 }
 
@@ -160,6 +352,15 @@ func (b *Writer) stopped() bool {
 }
 
 func (b *Writer) start() error {
+	// the context is canceled when the writer is closed,
+	// which cancels pending retries.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-b.close
+		cancel()
+	}()
+
 	for {
 		select {
 		case <-b.close:
@@ -173,12 +374,21 @@ func (b *Writer) start() error {
 				// are ephemeral and are considered low prioirty
 				// because they are not required for drone to
 				// operator, and the impact of failure is minimal
-				b.flush()
+				b.flush(ctx, b.policy())
 			}
 		}
 	}
 }
 
+// policy returns the retry policy used to send logs to the
+// server, or nil if the writer is not spooled.
+func (b *Writer) policy() *client.RetryPolicy {
+	if b.spool == nil {
+		return nil
+	}
+	return b.spool.policy()
+}
+
 func split(p []byte) []string {
 	s := string(p)
 	v := []string{s}
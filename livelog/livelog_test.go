@@ -11,6 +11,7 @@ import (
 
 	"github.com/drone/drone-go/drone"
 	"github.com/drone/runner-go/client"
+	"github.com/drone/runner-go/pipeline"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -75,6 +76,63 @@ func TestLineWriterLimit(t *testing.T) {
 	}
 }
 
+func TestLineWriterRetention(t *testing.T) {
+	client := new(mockClient)
+	w := New(client, 1)
+	w.SetRetention(8, 4)
+	w.Write([]byte("foo\n"))
+	w.Write([]byte("bar\n"))
+	w.Write([]byte("baz\n"))
+	w.Write([]byte("qux\n"))
+	w.Write([]byte("quux"))
+
+	if got, want := w.Truncated(), 2; got != want {
+		t.Errorf("Want %d truncated lines, got %d", want, got)
+	}
+
+	w.Close()
+	want := []*drone.Line{
+		{Number: 0, Message: "foo\n"},
+		{Number: 1, Message: "bar\n"},
+		{Number: 2, Message: "[2 lines truncated]\n"},
+		{Number: 4, Message: "quux"},
+	}
+	if diff := cmp.Diff(client.uploaded, want); diff != "" {
+		t.Errorf("Expect head and tail retained")
+		t.Log(diff)
+	}
+}
+
+// this test verifies that stream-tagged output is uploaded
+// with the untagged output.
+func TestLineWriterStream(t *testing.T) {
+	client := new(mockClient)
+	w := New(client, 1)
+	w.Write([]byte("foo"))
+	pipeline.WriteStream(w, pipeline.Stderr, []byte("bar"))
+	w.Close()
+
+	want := []*drone.Line{
+		{Number: 0, Message: "foo"},
+		{Number: 1, Message: "bar"},
+	}
+	if diff := cmp.Diff(client.uploaded, want); diff != "" {
+		t.Errorf("Expect stream-tagged lines uploaded")
+		t.Log(diff)
+	}
+}
+
+func TestLineWriterTimestamp(t *testing.T) {
+	client := new(mockClient)
+	w := New(client, 1)
+	w.now = time.Now().Add(-1500 * time.Millisecond)
+	w.Write([]byte("foo"))
+
+	if got, want := w.history[0].Timestamp, int64(1); got != want {
+		t.Errorf("Want timestamp %d seconds, got %d", want, got)
+	}
+}
+
 type mockClient struct {
 	client.Client
 	lines    []*drone.Line
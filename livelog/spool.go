@@ -0,0 +1,355 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package livelog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+)
+
+// spool file extension.
+const spoolExt = ".log"
+
+// DefaultSpoolRetry is the default policy used to retry
+// sending spooled logs to the server.
+var DefaultSpoolRetry = &client.RetryPolicy{
+	InitialInterval: time.Second,
+	MaxInterval:     10 * time.Second,
+	Multiplier:      2,
+	Jitter:          0.5,
+	MaxElapsedTime:  time.Minute,
+}
+
+// Spool persists log lines to disk as they are written, so
+// that logs are not lost if the server is unreachable or
+// the runner exits before the logs are uploaded. Each step
+// is spooled to a separate file in the directory, which is
+// removed once the logs are uploaded. The directory should
+// not be shared by multiple runners.
+type Spool struct {
+	// Dir is the directory where log files are spooled.
+	Dir string
+
+	// Retry is the policy used to retry sending logs to the
+	// server. If nil, DefaultSpoolRetry is used.
+	Retry *client.RetryPolicy
+}
+
+// NewSpool returns a new Spool that persists log files in
+// the directory. The directory is created if it does not
+// exist.
+func NewSpool(dir string) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Spool{Dir: dir}, nil
+}
+
+// Replay uploads logs that were spooled but not uploaded,
+// for example, because the runner exited before the step
+// completed. It should be invoked when the runner starts,
+// before any stage is executed. Logs are removed from the
+// spool once uploaded, and logs that cannot be uploaded are
+// retained and retried the next time Replay is invoked.
+func (s *Spool) Replay(ctx context.Context, client client.Client) error {
+	ids, err := s.list()
+	if err != nil {
+		return err
+	}
+	var first error
+	for _, id := range ids {
+		header, lines, err := s.read(id)
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		lines = header.trim(lines)
+		err = retry(ctx, s.policy(), func() error {
+			return client.Upload(ctx, id, lines)
+		})
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		s.remove(id)
+	}
+	return first
+}
+
+// list returns the identifiers of the spooled steps.
+func (s *Spool) list() ([]int64, error) {
+	infos, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, spoolExt) {
+			continue
+		}
+		id, err := strconv.ParseInt(strings.TrimSuffix(name, spoolExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// read reads the spool header and the spooled lines for the
+// step. A partially written line, for example, if the runner
+// crashed during a write, is ignored.
+func (s *Spool) read(id int64) (*spoolHeader, []*drone.Line, error) {
+	f, err := os.Open(s.path(id))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	header := &spoolHeader{Limit: defaultLimit}
+	var lines []*drone.Line
+	r := bufio.NewReader(f)
+	for first := true; ; first = false {
+		b, err := r.ReadBytes('\n')
+		if err != nil {
+			// the last line is ignored if it is not
+			// terminated by a newline.
+			break
+		}
+		if first {
+			record := new(spoolRecord)
+			if json.Unmarshal(b, record) == nil && record.Header != nil {
+				header = record.Header
+				continue
+			}
+		}
+		line := new(drone.Line)
+		if json.Unmarshal(b, line) == nil {
+			lines = append(lines, line)
+		}
+	}
+	return header, lines, nil
+}
+
+// open opens the spool file for the step.
+func (s *Spool) open(id int64) (*spoolFile, error) {
+	f, err := os.OpenFile(s.path(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &spoolFile{file: f, size: info.Size()}, nil
+}
+
+// remove removes the spool file for the step.
+func (s *Spool) remove(id int64) error {
+	return os.Remove(s.path(id))
+}
+
+// path returns the spool file path for the step.
+func (s *Spool) path(id int64) string {
+	return filepath.Join(s.Dir, fmt.Sprintf("%d%s", id, spoolExt))
+}
+
+// policy returns the retry policy.
+func (s *Spool) policy() *client.RetryPolicy {
+	if s.Retry == nil {
+		return DefaultSpoolRetry
+	}
+	return s.Retry
+}
+
+// spoolHeader is the first record of the spool file. It
+// stores the writer limit and retention, so that spooled
+// logs are replayed with the same trimming as the writer.
+type spoolHeader struct {
+	Limit     int `json:"limit"`
+	Head      int `json:"head"`
+	Tail      int `json:"tail"`
+	Truncated int `json:"truncated"`
+}
+
+// spoolRecord wraps the spool header, which distinguishes
+// the header from a log line.
+type spoolRecord struct {
+	Header *spoolHeader `json:"header"`
+}
+
+// trim returns the lines a writer with the header limit and
+// retention would upload.
+func (h *spoolHeader) trim(lines []*drone.Line) []*drone.Line {
+	w := &Writer{
+		limit: h.Limit,
+		head:  h.Head,
+		tail:  h.Tail,
+		now:   time.Now(),
+		close: make(chan struct{}),
+	}
+	if !w.retained() {
+		if w.limit <= 0 {
+			w.limit = defaultLimit
+		}
+		return truncate(lines, w.limit)
+	}
+	for _, line := range lines {
+		w.retain(line)
+		w.size += len(line.Message)
+	}
+	// lines truncated before the spool was compacted are
+	// counted after the lines are retained, since the head
+	// of the log is only retained if nothing is truncated.
+	w.truncated += h.Truncated
+	if len(lines) != 0 {
+		last := lines[len(lines)-1].Timestamp
+		w.now = w.now.Add(-time.Duration(last) * time.Second)
+	}
+	return w.lines()
+}
+
+// spoolFile appends log lines to the spool file, encoded
+// as newline-delimited json. The first record of the file
+// is the spool header.
+type spoolFile struct {
+	sync.Mutex
+	file *os.File
+
+	// size is the size of the spool file, and base is the
+	// size of the spool file when it was last compacted.
+	size int64
+	base int64
+}
+
+// write appends the lines to the spool file. The header is
+// written before the first line.
+func (f *spoolFile) write(header *spoolHeader, lines []*drone.Line) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.size != 0 {
+		header = nil
+	}
+	return f.append(header, lines)
+}
+
+// compact replaces the contents of the spool file with the
+// header and the lines.
+func (f *spoolFile) compact(header *spoolHeader, lines []*drone.Line) error {
+	f.Lock()
+	defer f.Unlock()
+	if err := f.file.Truncate(0); err != nil {
+		return err
+	}
+	f.size = 0
+	err := f.append(header, lines)
+	f.base = f.size
+	return err
+}
+
+// full returns true if the spool file should be compacted,
+// because it has grown to twice its size after the last
+// compaction, or twice the limit in bytes.
+func (f *spoolFile) full(limit int) bool {
+	f.Lock()
+	defer f.Unlock()
+	base := f.base
+	if base < int64(limit) {
+		base = int64(limit)
+	}
+	return f.size > 2*base
+}
+
+// append appends the header, if not nil, and the lines to
+// the spool file. The caller must hold the lock.
+func (f *spoolFile) append(header *spoolHeader, lines []*drone.Line) error {
+	var buf []byte
+	if header != nil {
+		b, err := json.Marshal(&spoolRecord{Header: header})
+		if err != nil {
+			return err
+		}
+		buf = append(buf, b...)
+		buf = append(buf, '\n')
+	}
+	for _, line := range lines {
+		b, err := json.Marshal(line)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, b...)
+		buf = append(buf, '\n')
+	}
+	n, err := f.file.Write(buf)
+	f.size += int64(n)
+	return err
+}
+
+// close closes the spool file.
+func (f *spoolFile) close() error {
+	f.Lock()
+	defer f.Unlock()
+	return f.file.Close()
+}
+
+// retry invokes the function until it succeeds, the retry
+// policy is exhausted, or the context is canceled.
+func retry(ctx context.Context, policy *client.RetryPolicy, fn func() error) error {
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		if policy.MaxAttempts > 0 && attempt+1 >= policy.MaxAttempts {
+			return err
+		}
+		wait := policy.Interval(attempt)
+		if policy.MaxElapsedTime > 0 && time.Since(start)+wait > policy.MaxElapsedTime {
+			return err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// truncate returns the most recent lines that do not exceed
+// the limit in bytes.
+func truncate(lines []*drone.Line, limit int) []*drone.Line {
+	size := 0
+	for i := len(lines) - 1; i >= 0; i-- {
+		size += len(lines[i].Message)
+		if size > limit {
+			return lines[i+1:]
+		}
+	}
+	return lines
+}
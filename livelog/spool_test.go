@@ -0,0 +1,233 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package livelog
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var testRetry = &client.RetryPolicy{
+	InitialInterval: time.Millisecond,
+	MaxAttempts:     3,
+}
+
+func TestSpool(t *testing.T) {
+	spool, cleanup := testSpool(t)
+	defer cleanup()
+
+	client := &mockFailClient{failures: 2}
+	w := New(client, 1)
+	w.SetSpool(spool)
+	w.Write([]byte("foo\nbar\n"))
+
+	_, lines, err := spool.read(1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := []*drone.Line{
+		{Number: 0, Message: "foo\n"},
+		{Number: 1, Message: "bar\n"},
+		{Number: 2, Message: ""},
+	}
+	if diff := cmp.Diff(lines, want); diff != "" {
+		t.Errorf("Expect lines persisted to the spool")
+		t.Log(diff)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Error(err)
+	}
+	if diff := cmp.Diff(client.uploaded, want); diff != "" {
+		t.Errorf("Expect upload retried")
+		t.Log(diff)
+	}
+	if _, err := os.Stat(spool.path(1)); !os.IsNotExist(err) {
+		t.Errorf("Expect spool removed after upload")
+	}
+}
+
+func TestSpool_Replay(t *testing.T) {
+	spool, cleanup := testSpool(t)
+	defer cleanup()
+
+	client := &mockFailClient{failures: 100}
+	w := New(client, 1)
+	w.SetSpool(spool)
+	w.Write([]byte("foo\n"))
+	if err := w.Close(); err == nil {
+		t.Errorf("Expect upload error")
+	}
+	if _, err := os.Stat(spool.path(1)); err != nil {
+		t.Errorf("Expect spool retained after failed upload")
+	}
+
+	// simulate a partially written line.
+	f, _ := os.OpenFile(spool.path(1), os.O_WRONLY|os.O_APPEND, 0600)
+	f.WriteString(`{"pos":1,"out":"ba`)
+	f.Close()
+
+	client = &mockFailClient{failures: 1}
+	if err := spool.Replay(context.Background(), client); err != nil {
+		t.Error(err)
+	}
+	want := []*drone.Line{{Number: 0, Message: "foo\n"}}
+	if diff := cmp.Diff(client.uploaded, want); diff != "" {
+		t.Errorf("Expect spooled logs uploaded")
+		t.Log(diff)
+	}
+	if _, err := os.Stat(spool.path(1)); !os.IsNotExist(err) {
+		t.Errorf("Expect spool removed after replay")
+	}
+}
+
+func TestSpool_ReplayRetention(t *testing.T) {
+	spool, cleanup := testSpool(t)
+	defer cleanup()
+
+	client := &mockFailClient{failures: 100}
+	w := New(client, 1)
+	w.SetRetention(4, 8)
+	w.SetSpool(spool)
+	w.Write([]byte("foo\n"))
+	w.Write([]byte("bar\n"))
+	w.Write([]byte("baz\n"))
+	w.Write([]byte("qux\n"))
+	want := w.lines()
+	w.Close()
+
+	client = &mockFailClient{}
+	if err := spool.Replay(context.Background(), client); err != nil {
+		t.Error(err)
+	}
+	if diff := cmp.Diff(client.uploaded, want); diff != "" {
+		t.Errorf("Expect replayed logs retained like the writer")
+		t.Log(diff)
+	}
+}
+
+func TestSpool_Compact(t *testing.T) {
+	spool, cleanup := testSpool(t)
+	defer cleanup()
+
+	client := &mockFailClient{failures: 100}
+	w := New(client, 1)
+	w.SetLimit(8)
+	w.SetSpool(spool)
+	for i := 0; i < 100; i++ {
+		w.Write([]byte("foo\n"))
+	}
+	want := w.lines()
+
+	if got := w.file.size; got > 2*w.file.base {
+		t.Errorf("Expect spool file compacted, got %d bytes", got)
+	}
+	header, lines, err := spool.read(1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := header.Limit, 8; got != want {
+		t.Errorf("Want spooled limit %d, got %d", want, got)
+	}
+	if diff := cmp.Diff(header.trim(lines), want); diff != "" {
+		t.Errorf("Expect compacted spool to retain the log")
+		t.Log(diff)
+	}
+	w.Close()
+}
+
+func TestSpool_Batch(t *testing.T) {
+	spool, cleanup := testSpool(t)
+	defer cleanup()
+
+	client := &mockFailClient{failures: 100}
+	w := New(client, 1)
+	w.SetSpool(spool)
+	w.pending = []*drone.Line{{Number: 0, Message: "foo\n"}}
+
+	if err := w.flush(context.Background(), testRetry); err == nil {
+		t.Errorf("Expect batch error")
+	}
+	if got, want := client.batched, 3; got != want {
+		t.Errorf("Want %d batch attempts, got %d", want, got)
+	}
+	if got, want := len(w.pending), 1; got != want {
+		t.Errorf("Expect lines returned to the buffer")
+	}
+	w.Close()
+}
+
+func TestTruncate(t *testing.T) {
+	lines := []*drone.Line{
+		{Number: 0, Message: "foo"},
+		{Number: 1, Message: "bar"},
+		{Number: 2, Message: "baz"},
+	}
+	got := truncate(lines, 6)
+	if diff := cmp.Diff(got, lines[1:]); diff != "" {
+		t.Errorf("Expect oldest lines truncated")
+		t.Log(diff)
+	}
+}
+
+func testSpool(t *testing.T) (*Spool, func()) {
+	dir, err := ioutil.TempDir("", "livelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spool, err := NewSpool(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spool.Retry = testRetry
+	return spool, func() { os.RemoveAll(dir) }
+}
+
+// mock client that fails the first n requests.
+type mockFailClient struct {
+	client.Client
+
+	sync.Mutex
+	failures int
+	batched  int
+	uploaded []*drone.Line
+}
+
+func (m *mockFailClient) Batch(ctx context.Context, id int64, lines []*drone.Line) error {
+	m.Lock()
+	defer m.Unlock()
+	m.batched++
+	return m.fail()
+}
+
+func (m *mockFailClient) Upload(ctx context.Context, id int64, lines []*drone.Line) error {
+	m.Lock()
+	defer m.Unlock()
+	if err := m.fail(); err != nil {
+		return err
+	}
+	m.uploaded = lines
+	return nil
+}
+
+func (m *mockFailClient) fail() error {
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("server unavailable")
+	}
+	return nil
+}
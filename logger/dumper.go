@@ -39,11 +39,45 @@ type standardDumper struct {
 }
 
 func (s *standardDumper) DumpRequest(req *http.Request) {
-	dump, _ := httputil.DumpRequestOut(req, s.body)
+	// dump a shallow copy of the request with sensitive
+	// headers redacted, and restore the request body which
+	// is drained by the dump.
+	out := *req
+	out.Header = redact(req.Header)
+	dump, _ := httputil.DumpRequestOut(&out, s.body)
+	req.Body = out.Body
 	s.out.Write(dump)
 }
 
 func (s *standardDumper) DumpResponse(res *http.Response) {
-	dump, _ := httputil.DumpResponse(res, s.body)
+	out := *res
+	out.Header = redact(res.Header)
+	dump, _ := httputil.DumpResponse(&out, s.body)
+	res.Body = out.Body
 	s.out.Write(dump)
 }
+
+// sensitive headers that are redacted from the dump.
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Proxy-Authorization",
+	"Set-Cookie",
+	"X-Drone-Signature",
+	"X-Drone-Token",
+}
+
+// helper function returns a copy of the headers with the
+// sensitive header values redacted.
+func redact(header http.Header) http.Header {
+	out := http.Header{}
+	for k, v := range header {
+		out[k] = v
+	}
+	for _, k := range sensitiveHeaders {
+		if _, ok := out[k]; ok {
+			out.Set(k, "[REDACTED]")
+		}
+	}
+	return out
+}
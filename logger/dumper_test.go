@@ -6,8 +6,10 @@ package logger
 
 import (
 	"bytes"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -41,6 +43,28 @@ func TestStandardDumper_DumpRequest(t *testing.T) {
 	}
 }
 
+func TestStandardDumper_Redact(t *testing.T) {
+	buf := new(bytes.Buffer)
+	r, _ := http.NewRequest("POST", "http://example.com", strings.NewReader("hello"))
+	r.Header.Set("X-Drone-Token", "correct-horse-battery-staple")
+	d := StandardDumper(true).(*standardDumper)
+	d.out = buf
+	d.DumpRequest(r)
+
+	if strings.Contains(buf.String(), "correct-horse-battery-staple") {
+		t.Errorf("Expect token redacted from dumped request")
+	}
+	if !strings.Contains(buf.String(), "X-Drone-Token: [REDACTED]") {
+		t.Errorf("Expect redacted token in dumped request")
+	}
+	if got, want := r.Header.Get("X-Drone-Token"), "correct-horse-battery-staple"; got != want {
+		t.Errorf("Expect request header not modified")
+	}
+	if b, _ := ioutil.ReadAll(r.Body); string(b) != "hello" {
+		t.Errorf("Expect request body restored after dump")
+	}
+}
+
 func TestStandardDumper_DumpResponse(t *testing.T) {
 	buf := new(bytes.Buffer)
 	r := &http.Response{
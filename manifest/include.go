@@ -0,0 +1,349 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/buildkite/yaml"
+)
+
+// KindInclude is the kind of a resource document that
+// includes the resources defined in another file.
+const KindInclude = "include"
+
+// DefaultIncludeDepth is the default maximum depth of
+// nested includes.
+const DefaultIncludeDepth = 10
+
+// keys of the resource lists that may contain includes.
+var includeLists = []string{"steps", "services"}
+
+// ErrIncludeDepth is returned when nested includes exceed
+// the maximum include depth.
+var ErrIncludeDepth = errors.New("yaml: maximum include depth exceeded")
+
+type (
+	// Resolver resolves the contents of an included file.
+	Resolver interface {
+		Resolve(path string) ([]byte, error)
+	}
+
+	// ResolverFunc is an adapter to allow the use of an
+	// ordinary function as a Resolver.
+	ResolverFunc func(path string) ([]byte, error)
+
+	// FileResolver resolves included files from the local
+	// filesystem. Paths are resolved relative to the
+	// repository root, falling back to the shared
+	// directory when the file does not exist in the
+	// repository.
+	FileResolver struct {
+		Root   string
+		Shared string
+	}
+
+	// Include is a resource document that includes the
+	// resources defined in another file.
+	Include struct {
+		Kind string `json:"kind"`
+		Path string `json:"path"`
+	}
+)
+
+// Resolve calls f(path).
+func (f ResolverFunc) Resolve(path string) ([]byte, error) {
+	return f(path)
+}
+
+// Resolve returns the contents of the file at path.
+func (r *FileResolver) Resolve(path string) ([]byte, error) {
+	out, err := ioutil.ReadFile(joinPath(r.Root, path))
+	if os.IsNotExist(err) && r.Shared != "" {
+		return ioutil.ReadFile(joinPath(r.Shared, path))
+	}
+	return out, err
+}
+
+// expander expands included files.
+type expander struct {
+	resolver Resolver
+	depth    int
+	stack    []string
+}
+
+// includedResource is a raw resource and whether or not
+// the resource was included from another file.
+type includedResource struct {
+	*RawResource
+	included bool
+}
+
+// expand expands the include documents and include list
+// items in the raw resources.
+func (e *expander) expand(resources []*RawResource) ([]*RawResource, error) {
+	items, err := e.expandResources(resources, false)
+	if err != nil {
+		return nil, err
+	}
+	var out []*includedResource
+	for _, item := range items {
+		index := -1
+		for i, existing := range out {
+			if (item.included || existing.included) &&
+				existing.Kind == item.Kind &&
+				existing.Name == item.Name {
+				index = i
+				break
+			}
+		}
+		switch {
+		case index == -1:
+			out = append(out, item)
+		case item.included && !out[index].included:
+			// local resources take precedence over
+			// included resources.
+		default:
+			out[index] = item
+		}
+	}
+	var res []*RawResource
+	for _, item := range out {
+		res = append(res, item.RawResource)
+	}
+	return res, nil
+}
+
+func (e *expander) expandResources(resources []*RawResource, included bool) ([]*includedResource, error) {
+	var out []*includedResource
+	for _, resource := range resources {
+		if resource == nil {
+			continue
+		}
+		if resource.Kind != KindInclude {
+			err := e.expandLists(resource)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, &includedResource{resource, included})
+			continue
+		}
+		include := new(Include)
+		err := yaml.Unmarshal(resource.Data, include)
+		if err != nil {
+			return nil, err
+		}
+		data, err := e.push(include.Path)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := ParseRawBytes(data)
+		if err != nil {
+			return nil, err
+		}
+		items, err := e.expandResources(raw, true)
+		if err != nil {
+			return nil, err
+		}
+		e.pop()
+		out = append(out, items...)
+	}
+	return out, nil
+}
+
+// expandLists expands the include items in the resource
+// lists and re-encodes the resource data.
+func (e *expander) expandLists(resource *RawResource) error {
+	doc := yaml.MapSlice{}
+	err := yaml.Unmarshal(resource.Data, &doc)
+	if err != nil {
+		return err
+	}
+	var changed bool
+	for i, item := range doc {
+		if !isIncludeList(item.Key) {
+			continue
+		}
+		list, ok := item.Value.([]interface{})
+		if !ok || !hasInclude(list) {
+			continue
+		}
+		list, err = e.expandList(list)
+		if err != nil {
+			return err
+		}
+		doc[i].Value = list
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	resource.Data = data
+	return nil
+}
+
+// expandList expands the include items in the list. A
+// local item replaces an included item with the same name.
+func (e *expander) expandList(list []interface{}) ([]interface{}, error) {
+	items, err := e.expandItems(list, false)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	var flags []bool
+	for _, item := range items {
+		index := -1
+		name := itemName(item.value)
+		for i, existing := range out {
+			if name != "" && (item.included || flags[i]) &&
+				itemName(existing) == name {
+				index = i
+				break
+			}
+		}
+		switch {
+		case index == -1:
+			out = append(out, item.value)
+			flags = append(flags, item.included)
+		case item.included && !flags[index]:
+			// local items take precedence over
+			// included items.
+		default:
+			out[index] = item.value
+			flags[index] = item.included
+		}
+	}
+	return out, nil
+}
+
+// includedItem is a list item and whether or not the item
+// was included from another file.
+type includedItem struct {
+	value    interface{}
+	included bool
+}
+
+func (e *expander) expandItems(list []interface{}, included bool) ([]*includedItem, error) {
+	var out []*includedItem
+	for _, item := range list {
+		path, ok := includePath(item)
+		if !ok {
+			out = append(out, &includedItem{item, included})
+			continue
+		}
+		data, err := e.push(path)
+		if err != nil {
+			return nil, err
+		}
+		var maps []yaml.MapSlice
+		err = yaml.Unmarshal(data, &maps)
+		if err != nil {
+			return nil, err
+		}
+		var list []interface{}
+		for _, m := range maps {
+			list = append(list, m)
+		}
+		items, err := e.expandItems(list, true)
+		if err != nil {
+			return nil, err
+		}
+		e.pop()
+		out = append(out, items...)
+	}
+	return out, nil
+}
+
+// push resolves the included file and pushes the path
+// onto the include stack.
+func (e *expander) push(name string) ([]byte, error) {
+	if name == "" {
+		return nil, errors.New("yaml: include path is empty")
+	}
+	name = path.Clean(name)
+	for i, prev := range e.stack {
+		if prev == name {
+			chain := append(e.stack[i:], name)
+			return nil, fmt.Errorf("yaml: include cycle: %s",
+				strings.Join(chain, " -> "))
+		}
+	}
+	if len(e.stack) >= e.depth {
+		return nil, ErrIncludeDepth
+	}
+	data, err := e.resolver.Resolve(name)
+	if err != nil {
+		return nil, fmt.Errorf("yaml: cannot include %s: %s", name, err)
+	}
+	e.stack = append(e.stack, name)
+	return data, nil
+}
+
+// pop pops the last path from the include stack.
+func (e *expander) pop() {
+	e.stack = e.stack[:len(e.stack)-1]
+}
+
+// helper function returns true if the key names a list
+// that may contain include items.
+func isIncludeList(key interface{}) bool {
+	for _, name := range includeLists {
+		if key == name {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function returns true if the list contains an
+// include item.
+func hasInclude(list []interface{}) bool {
+	for _, item := range list {
+		if _, ok := includePath(item); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function returns the include path if the list
+// item is an include item.
+func includePath(item interface{}) (string, bool) {
+	m, ok := item.(yaml.MapSlice)
+	if !ok || len(m) != 1 || m[0].Key != KindInclude {
+		return "", false
+	}
+	s, ok := m[0].Value.(string)
+	return s, ok
+}
+
+// helper function returns the name of the list item.
+func itemName(item interface{}) string {
+	m, _ := item.(yaml.MapSlice)
+	for _, v := range m {
+		if v.Key == "name" {
+			s, _ := v.Value.(string)
+			return s
+		}
+	}
+	return ""
+}
+
+// helper function joins the root directory and the path,
+// preventing the path from escaping the root directory.
+func joinPath(root, name string) string {
+	name = path.Clean("/" + filepath.ToSlash(name))
+	return filepath.Join(root, filepath.FromSlash(name))
+}
@@ -0,0 +1,227 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package manifest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/buildkite/yaml"
+	"github.com/google/go-cmp/cmp"
+)
+
+// helper function returns a resolver that resolves files
+// from the map.
+func mapResolver(files map[string]string) Resolver {
+	return ResolverFunc(func(path string) ([]byte, error) {
+		s, ok := files[path]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return []byte(s), nil
+	})
+}
+
+func TestParseInclude(t *testing.T) {
+	resolver := mapResolver(map[string]string{
+		"shared/secrets.yml": `
+kind: secret
+name: username
+get:
+  path: secret/docker
+  name: username
+---
+kind: secret
+name: password
+get:
+  path: secret/docker
+  name: password
+`,
+	})
+	m, err := Parse(strings.NewReader(`
+kind: include
+path: shared/secrets.yml
+---
+kind: secret
+name: password
+data: local
+`), WithResolver(resolver))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := []Resource{
+		&Secret{
+			Kind: "secret",
+			Name: "username",
+			Get:  SecretGet{Path: "secret/docker", Name: "username"},
+		},
+		&Secret{
+			Kind: "secret",
+			Name: "password",
+			Data: "local",
+		},
+	}
+	if diff := cmp.Diff(m.Resources, want); diff != "" {
+		t.Errorf("Unexpected included resources")
+		t.Log(diff)
+	}
+}
+
+func TestParseInclude_Steps(t *testing.T) {
+	resolver := mapResolver(map[string]string{
+		"shared/steps.yml": `
+- name: lint
+  image: golang
+- include: shared/nested.yml
+`,
+		"shared/nested.yml": `
+- name: test
+  image: golang
+  commands: [ go test ]
+`,
+	})
+	resources, err := ParseRawString(`
+kind: pipeline
+name: default
+steps:
+- include: shared/steps.yml
+- name: test
+  image: golang:1.12
+`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	e := &expander{resolver: resolver, depth: DefaultIncludeDepth}
+	resources, err = e.expand(resources)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	got := struct {
+		Steps []map[string]interface{}
+	}{}
+	yaml.Unmarshal(resources[0].Data, &got)
+	want := []map[string]interface{}{
+		{"name": "lint", "image": "golang"},
+		{"name": "test", "image": "golang:1.12"},
+	}
+	if diff := cmp.Diff(got.Steps, want); diff != "" {
+		t.Errorf("Unexpected included steps")
+		t.Log(diff)
+	}
+}
+
+func TestParseInclude_Cycle(t *testing.T) {
+	resolver := mapResolver(map[string]string{
+		"a.yml": "kind: include\npath: b.yml",
+		"b.yml": "kind: include\npath: ./a.yml",
+	})
+	_, err := Parse(strings.NewReader("kind: include\npath: a.yml"), WithResolver(resolver))
+	if err == nil {
+		t.Errorf("Expect include cycle error")
+		return
+	}
+	if got, want := err.Error(), "yaml: include cycle: a.yml -> b.yml -> a.yml"; got != want {
+		t.Errorf("Want error %q, got %q", want, got)
+	}
+}
+
+func TestParseInclude_Depth(t *testing.T) {
+	resolver := mapResolver(map[string]string{
+		"a.yml": "kind: include\npath: b.yml",
+		"b.yml": "kind: include\npath: c.yml",
+		"c.yml": "kind: secret\nname: password\ndata: foo",
+	})
+	_, err := Parse(strings.NewReader("kind: include\npath: a.yml"), WithResolver(resolver), WithIncludeDepth(2))
+	if err != ErrIncludeDepth {
+		t.Errorf("Expect include depth error, got %v", err)
+	}
+	_, err = Parse(strings.NewReader("kind: include\npath: a.yml"), WithResolver(resolver), WithIncludeDepth(3))
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseInclude_NotFound(t *testing.T) {
+	resolver := mapResolver(map[string]string{})
+	_, err := Parse(strings.NewReader("kind: include\npath: a.yml"), WithResolver(resolver))
+	if err == nil {
+		t.Errorf("Expect include not found error")
+	}
+}
+
+func TestParseInclude_NoResolver(t *testing.T) {
+	m, err := Parse(strings.NewReader("kind: include\npath: a.yml"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(m.Resources) != 0 {
+		t.Errorf("Expect include ignored without a resolver")
+	}
+}
+
+func TestParseString_Include(t *testing.T) {
+	resolver := mapResolver(map[string]string{
+		"a.yml": "kind: secret\nname: password\ndata: foo",
+	})
+	m, err := ParseString("kind: include\npath: a.yml", WithResolver(resolver))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := len(m.Resources), 1; got != want {
+		t.Errorf("Want %d included resources, got %d", want, got)
+	}
+}
+
+func TestFileResolver(t *testing.T) {
+	root, err := ioutil.TempDir("", "drone")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(root)
+
+	os.MkdirAll(filepath.Join(root, "repo"), 0700)
+	os.MkdirAll(filepath.Join(root, "shared"), 0700)
+	ioutil.WriteFile(filepath.Join(root, "repo", "a.yml"), []byte("repo"), 0600)
+	ioutil.WriteFile(filepath.Join(root, "shared", "a.yml"), []byte("shared"), 0600)
+	ioutil.WriteFile(filepath.Join(root, "shared", "b.yml"), []byte("shared"), 0600)
+	ioutil.WriteFile(filepath.Join(root, "secret.yml"), []byte("secret"), 0600)
+
+	resolver := &FileResolver{
+		Root:   filepath.Join(root, "repo"),
+		Shared: filepath.Join(root, "shared"),
+	}
+	tests := []struct {
+		path string
+		data string
+		err  bool
+	}{
+		{path: "a.yml", data: "repo"},
+		{path: "b.yml", data: "shared"},
+		{path: "../secret.yml", err: true},
+		{path: "c.yml", err: true},
+	}
+	for _, test := range tests {
+		data, err := resolver.Resolve(test.path)
+		if test.err && err == nil {
+			t.Errorf("Expect error resolving %s", test.path)
+		}
+		if !test.err && err != nil {
+			t.Errorf("Expect no error resolving %s, got %s", test.path, err)
+		}
+		if got, want := string(data), test.data; got != want {
+			t.Errorf("Want %s contents %q, got %q", test.path, want, got)
+		}
+	}
+}
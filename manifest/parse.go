@@ -14,12 +14,63 @@ import (
 	"github.com/buildkite/yaml"
 )
 
-// Parse parses the configuration from io.Reader r.
-func Parse(r io.Reader) (*Manifest, error) {
+// Option configures the parser.
+type Option func(*options)
+
+// options stores the parser options.
+type options struct {
+	resolver Resolver
+	depth    int
+}
+
+// WithResolver returns an option that configures the parser
+// to expand included files using the Resolver. Included
+// files are ignored if no Resolver is configured.
+func WithResolver(resolver Resolver) Option {
+	return func(o *options) {
+		o.resolver = resolver
+	}
+}
+
+// WithIncludeDepth returns an option that configures the
+// maximum depth of nested includes.
+func WithIncludeDepth(depth int) Option {
+	return func(o *options) {
+		o.depth = depth
+	}
+}
+
+// Parse parses the configuration from io.Reader r. If the
+// parser is configured with a Resolver, included resources
+// are inserted in place of the include document, and
+// included list items are inserted in place of the include
+// item. A locally defined resource or list item replaces an
+// included resource or item with the same name.
+func Parse(r io.Reader, opts ...Option) (*Manifest, error) {
+	o := &options{depth: DefaultIncludeDepth}
+	for _, opt := range opts {
+		opt(o)
+	}
 	resources, err := ParseRaw(r)
 	if err != nil {
 		return nil, err
 	}
+	if o.resolver != nil {
+		e := &expander{
+			resolver: o.resolver,
+			depth:    o.depth,
+		}
+		resources, err = e.expand(resources)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return parseResources(resources)
+}
+
+// helper function parses the raw resources using the
+// registered drivers.
+func parseResources(resources []*RawResource) (*Manifest, error) {
 	manifest := new(Manifest)
 	for _, raw := range resources {
 		if raw == nil {
@@ -41,27 +92,29 @@ func Parse(r io.Reader) (*Manifest, error) {
 }
 
 // ParseBytes parses the configuration from bytes b.
-func ParseBytes(b []byte) (*Manifest, error) {
+func ParseBytes(b []byte, opts ...Option) (*Manifest, error) {
 	return Parse(
 		bytes.NewBuffer(b),
+		opts...,
 	)
 }
 
 // ParseString parses the configuration from string s.
-func ParseString(s string) (*Manifest, error) {
+func ParseString(s string, opts ...Option) (*Manifest, error) {
 	return ParseBytes(
 		[]byte(s),
+		opts...,
 	)
 }
 
 // ParseFile parses the configuration from path p.
-func ParseFile(p string) (*Manifest, error) {
+func ParseFile(p string, opts ...Option) (*Manifest, error) {
 	f, err := os.Open(p)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
-	return Parse(f)
+	return Parse(f, opts...)
 }
 
 func parseRaw(r *RawResource) (Resource, error) {
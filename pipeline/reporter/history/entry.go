@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/pipeline"
 )
 
 // Entry represents a history entry.
@@ -17,6 +18,23 @@ type Entry struct {
 	Repo    *drone.Repo  `json:"repo"`
 	Created time.Time    `json:"created"`
 	Updated time.Time    `json:"updated"`
+	Logs    []*Line      `json:"logs,omitempty"`
+}
+
+// Filter returns the log lines from the named stream. If
+// the stream is empty, all log lines are returned. Lines
+// that are not tagged with a stream are considered stdout.
+func (e *Entry) Filter(stream pipeline.Stream) []*Line {
+	if stream == "" {
+		return e.Logs
+	}
+	var lines []*Line
+	for _, line := range e.Logs {
+		if line.Stream == stream || (line.Stream == "" && stream == pipeline.Stdout) {
+			lines = append(lines, line)
+		}
+	}
+	return lines
 }
 
 // ByTimestamp sorts a list of entries by timestamp
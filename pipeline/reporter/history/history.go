@@ -24,9 +24,10 @@ const defaultLimit = 25
 // processed by the system.
 type History struct {
 	sync.Mutex
-	base  pipeline.Reporter
-	limit int
-	items []*Entry
+	base     pipeline.Reporter
+	limit    int
+	logLimit int
+	items    []*Entry
 }
 
 // New returns a new History recorder that wraps the base
@@ -0,0 +1,119 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package history
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/drone/runner-go/pipeline"
+)
+
+var _ pipeline.Streamer = (*History)(nil)
+
+// default number of log lines retained for each entry.
+const defaultLogLimit = 1000
+
+// Line represents a line of step output.
+type Line struct {
+	Step    string          `json:"step"`
+	Number  int             `json:"pos"`
+	Message string          `json:"out"`
+	Stream  pipeline.Stream `json:"stream,omitempty"`
+	Time    time.Time       `json:"time"`
+	Elapsed time.Duration   `json:"elapsed"`
+}
+
+// Stream returns an io.WriteCloser that records the step
+// output in the history, and streams the output to the base
+// reporter if it implements pipeline.Streamer. Only the most
+// recent lines are retained.
+func (h *History) Stream(ctx context.Context, state *pipeline.State, name string) io.WriteCloser {
+	var base io.WriteCloser
+	if streamer, ok := h.base.(pipeline.Streamer); ok {
+		base = streamer.Stream(ctx, state, name)
+	} else {
+		base = pipeline.NopStreamer().Stream(ctx, state, name)
+	}
+	state.Lock()
+	id := state.Stage.ID
+	state.Unlock()
+	return &recorder{
+		base:    base,
+		history: h,
+		stage:   id,
+		step:    name,
+		start:   time.Now(),
+	}
+}
+
+// LogLimit returns the number of log lines retained for
+// each entry.
+func (h *History) LogLimit() int {
+	if h.logLimit == 0 {
+		return defaultLogLimit
+	}
+	return h.logLimit
+}
+
+// record appends the lines to the entry.
+func (h *History) record(stage int64, lines []*Line) {
+	h.Lock()
+	defer h.Unlock()
+	for _, v := range h.items {
+		if v.Stage.ID != stage {
+			continue
+		}
+		v.Logs = append(v.Logs, lines...)
+		if n := len(v.Logs) - h.LogLimit(); n > 0 {
+			v.Logs = v.Logs[n:]
+		}
+		return
+	}
+}
+
+// recorder is an io.WriteCloser that records the step output
+// in the history.
+type recorder struct {
+	base    io.WriteCloser
+	history *History
+	stage   int64
+	step    string
+	start   time.Time
+	num     int
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.record("", p)
+	return r.base.Write(p)
+}
+
+func (r *recorder) WriteStream(stream pipeline.Stream, p []byte) (int, error) {
+	r.record(stream, p)
+	return pipeline.WriteStream(r.base, stream, p)
+}
+
+func (r *recorder) Close() error {
+	return r.base.Close()
+}
+
+func (r *recorder) record(stream pipeline.Stream, p []byte) {
+	now := time.Now()
+	var lines []*Line
+	for _, part := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		r.num++
+		lines = append(lines, &Line{
+			Step:    r.step,
+			Number:  r.num,
+			Message: part,
+			Stream:  stream,
+			Time:    now,
+			Elapsed: now.Sub(r.start),
+		})
+	}
+	r.history.record(r.stage, lines)
+}
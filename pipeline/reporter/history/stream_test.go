@@ -0,0 +1,68 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package history
+
+import (
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/pipeline"
+)
+
+func TestStream(t *testing.T) {
+	state := &pipeline.State{
+		Repo:  &drone.Repo{ID: 1},
+		Build: &drone.Build{ID: 2},
+		Stage: &drone.Stage{ID: 3},
+	}
+	v := New(&nopReporter{})
+	v.ReportStage(nil, state)
+
+	w := v.Stream(nil, state, "clone")
+	w.Write([]byte("hello\nworld\n"))
+	pipeline.WriteStream(w, pipeline.Stderr, []byte("fatal"))
+	w.Close()
+
+	entry := v.Entry(3)
+	if got, want := len(entry.Logs), 3; got != want {
+		t.Errorf("Want %d lines recorded, got %d", want, got)
+		return
+	}
+	if got, want := entry.Logs[2].Message, "fatal"; got != want {
+		t.Errorf("Want message %q, got %q", want, got)
+	}
+	if got, want := entry.Logs[2].Number, 3; got != want {
+		t.Errorf("Want line number %d, got %d", want, got)
+	}
+	if got, want := len(entry.Filter(pipeline.Stderr)), 1; got != want {
+		t.Errorf("Want %d stderr lines, got %d", want, got)
+	}
+	if got, want := len(entry.Filter(pipeline.Stdout)), 2; got != want {
+		t.Errorf("Want %d stdout lines, got %d", want, got)
+	}
+}
+
+func TestStreamLimit(t *testing.T) {
+	state := &pipeline.State{
+		Repo:  &drone.Repo{ID: 1},
+		Build: &drone.Build{ID: 2},
+		Stage: &drone.Stage{ID: 3},
+	}
+	v := New(&nopReporter{})
+	v.logLimit = 2
+	v.ReportStage(nil, state)
+
+	w := v.Stream(nil, state, "clone")
+	w.Write([]byte("foo\nbar\nbaz\n"))
+
+	entry := v.Entry(3)
+	if got, want := len(entry.Logs), 2; got != want {
+		t.Errorf("Want %d lines retained, got %d", want, got)
+		return
+	}
+	if got, want := entry.Logs[0].Message, "bar"; got != want {
+		t.Errorf("Want oldest lines discarded, got %q", got)
+	}
+}
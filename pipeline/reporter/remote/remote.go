@@ -23,6 +23,9 @@ var _ pipeline.Streamer = (*Remote)(nil)
 // changes and results to a remote server instance.
 type Remote struct {
 	client client.Client
+	spool  *livelog.Spool
+	head   int
+	tail   int
 }
 
 // New returns a remote reporter.
@@ -32,6 +35,20 @@ func New(client client.Client) *Remote {
 	}
 }
 
+// SetSpool sets the spool used to persist step logs to disk
+// until they are uploaded to the server.
+func (s *Remote) SetSpool(spool *livelog.Spool) {
+	s.spool = spool
+}
+
+// SetRetention sets the number of bytes retained from the
+// head and tail of step logs that exceed the limit. The
+// number of truncated lines is recorded in the step metadata.
+func (s *Remote) SetRetention(head, tail int) {
+	s.head = head
+	s.tail = tail
+}
+
 // ReportStage reports the stage status.
 func (s *Remote) ReportStage(ctx context.Context, state *pipeline.State) error {
 	state.Lock()
@@ -66,5 +83,31 @@ func (s *Remote) ReportStep(ctx context.Context, state *pipeline.State, name str
 // and stderr of the pipeline step to the server.
 func (s *Remote) Stream(ctx context.Context, state *pipeline.State, name string) io.WriteCloser {
 	src := state.Find(name)
-	return livelog.New(s.client, src.ID)
+	w := livelog.New(s.client, src.ID)
+	if s.spool != nil {
+		w.SetSpool(s.spool)
+	}
+	if s.head == 0 && s.tail == 0 {
+		return w
+	}
+	w.SetRetention(s.head, s.tail)
+	return &stream{Writer: w, state: state, name: name}
+}
+
+// stream records the number of truncated log lines in the
+// step metadata when the stream is closed.
+type stream struct {
+	*livelog.Writer
+	state *pipeline.State
+	name  string
+}
+
+func (s *stream) Close() error {
+	err := s.Writer.Close()
+	if n := s.Writer.Truncated(); n > 0 {
+		s.state.UpdateMeta(s.name, func(meta *pipeline.Meta) {
+			meta.LogTruncated = n
+		})
+	}
+	return err
 }
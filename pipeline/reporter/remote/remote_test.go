@@ -100,6 +100,49 @@ func TestStream(t *testing.T) {
 	}
 }
 
+func TestStream_Retention(t *testing.T) {
+	state := &pipeline.State{
+		Stage: &drone.Stage{
+			Steps: []*drone.Step{
+				{
+					ID:   1,
+					Name: "clone",
+				},
+			},
+		},
+	}
+
+	c := new(mockLogClient)
+	r := New(c)
+	r.SetRetention(4, 4)
+	w := r.Stream(nocontext, state, "clone")
+	w.Write([]byte("foo\nbar\nbaz\nqux\n"))
+	if err := w.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if got, want := state.FindMeta("clone").LogTruncated, 2; got != want {
+		t.Errorf("Want %d truncated lines in step metadata, got %d", want, got)
+	}
+	if got, want := len(c.uploaded), 4; got != want {
+		t.Errorf("Want %d uploaded lines, got %d", want, got)
+	}
+}
+
+type mockLogClient struct {
+	client.Client
+	uploaded []*drone.Line
+}
+
+func (m *mockLogClient) Batch(context.Context, int64, []*drone.Line) error {
+	return nil
+}
+
+func (m *mockLogClient) Upload(_ context.Context, _ int64, lines []*drone.Line) error {
+	m.uploaded = lines
+	return nil
+}
+
 type mockClient struct {
 	*client.HTTPClient
 }
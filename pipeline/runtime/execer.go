@@ -6,6 +6,10 @@ package runtime
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
 	"sync"
 
 	"github.com/drone/drone-go/drone"
@@ -13,12 +17,16 @@ import (
 	"github.com/drone/runner-go/livelog/extractor"
 	"github.com/drone/runner-go/logger"
 	"github.com/drone/runner-go/pipeline"
+	"github.com/drone/runner-go/testreport"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/natessilva/dag"
 	"golang.org/x/sync/semaphore"
 )
 
+// maximum size of a test report read from the workspace.
+const maxReportSize = 10485760
+
 // Execer executes the pipeline.
 type Execer struct {
 	mu       sync.Mutex
@@ -27,6 +35,8 @@ type Execer struct {
 	streamer pipeline.Streamer
 	uploader pipeline.Uploader
 	sem      *semaphore.Weighted
+	redact   []*regexp.Regexp
+	schema   string
 }
 
 // NewExecer returns a new execer.
@@ -51,6 +61,27 @@ func NewExecer(
 	return exec
 }
 
+// SetRedact sets the regular expressions used to redact
+// sensitive data from the step output, in addition to the
+// masked secrets. Output matching a pattern is redacted one
+// line at a time.
+func (e *Execer) SetRedact(patterns ...*regexp.Regexp) {
+	e.mu.Lock()
+	e.redact = patterns
+	e.mu.Unlock()
+}
+
+// SetTestCardSchema sets the schema url of the test summary
+// card. The test summary card is opt-in: there is no default
+// schema, and the card is not uploaded unless the schema url
+// is set to a schema the server can render. The test results
+// are stored in the pipeline state either way.
+func (e *Execer) SetTestCardSchema(schema string) {
+	e.mu.Lock()
+	e.schema = schema
+	e.mu.Unlock()
+}
+
 // Exec executes the intermediate representation of the pipeline
 // and returns an error if execution fails.
 func (e *Execer) Exec(ctx context.Context, spec Spec, state *pipeline.State) error {
@@ -221,20 +252,31 @@ func (e *Execer) exec(ctx context.Context, state *pipeline.State, spec Spec, ste
 
 	// the pipeline environment variables need to be updated to
 	// reflect the current state of the build and stage.
+	tests, ok := state.Tests()
 	state.Lock()
-	copy.SetEnviron(
-		environ.Combine(
-			copy.GetEnviron(),
-			environ.Build(state.Build),
-			environ.Stage(state.Stage),
-			environ.Step(findStep(state, step.GetName())),
-		),
-	)
+	envs := []map[string]string{
+		copy.GetEnviron(),
+		environ.Build(state.Build),
+		environ.Stage(state.Stage),
+		environ.Step(findStep(state, step.GetName())),
+	}
 	state.Unlock()
+	// the test results are exposed once a step reports test
+	// results, so that zero counts are not mistaken for a
+	// passing test run.
+	if ok {
+		envs = append(envs, testreport.Environ(tests))
+	}
+	copy.SetEnviron(environ.Combine(envs...))
 
 	// writer used to stream build logs.
 	wc := e.streamer.Stream(noContext, state, step.GetName())
-	wc = newReplacer(wc, secretSlice(step))
+	e.mu.Lock()
+	redact := e.redact
+	schema := e.schema
+	e.mu.Unlock()
+	secrets := append(secretSlice(step), SecretsFrom(ctx)...)
+	wc = newReplacer(wc, secrets, redact...)
 
 	// wrap writer in extrator
 	ext := extractor.New(wc)
@@ -244,6 +286,7 @@ func (e *Execer) exec(ctx context.Context, state *pipeline.State, spec Spec, ste
 	if step.IsDetached() {
 		go func() {
 			e.engine.Run(ctx, spec, copy, ext)
+			ext.Flush()
 			wc.Close()
 		}()
 		return nil
@@ -251,18 +294,60 @@ func (e *Execer) exec(ctx context.Context, state *pipeline.State, spec Spec, ste
 
 	exited, err := e.engine.Run(ctx, spec, copy, ext)
 
+	// flush the output buffered by the extractor, which may
+	// include a partial card.
+	if err := ext.Flush(); err != nil {
+		result = multierror.Append(result, err)
+	}
+
 	// close the stream. If the session is a remote session, the
 	// full log buffer is uploaded to the remote server.
 	if err := wc.Close(); err != nil {
 		result = multierror.Append(result, err)
 	}
 
-	// upload card if exists
-	card, ok := ext.File()
-	if ok {
-		err = e.uploader.UploadCard(ctx, card, state, step.GetName())
-		if err != nil {
-			log.Warnln("cannot upload card")
+	// upload cards if exist
+	for _, err := range ext.Rejected() {
+		log.WithError(err).Warnln("cannot upload card")
+	}
+
+	// the server stores a single card per step, and each card
+	// would replace the previous card. The first card is
+	// uploaded and the remaining cards are dropped.
+	cards := ext.Cards()
+	if len(cards) > 1 {
+		for _, card := range cards[1:] {
+			log.WithField("card", card.Name).
+				Warnln("cannot upload card: a step supports a single card")
+		}
+		cards = cards[:1]
+	}
+
+	if report := e.collectTests(ctx, spec, copy, ext); report != nil {
+		state.UpdateMeta(step.GetName(), func(meta *pipeline.Meta) {
+			meta.Tests = report
+		})
+		// the card written by the step takes precedence over
+		// the test summary card.
+		switch {
+		case schema == "":
+			log.Debugln("skip test summary card: no card schema configured")
+		case len(cards) != 0:
+			log.WithField("card", cards[0].Name).
+				Infoln("skip test summary card: the step uploads a card")
+		default:
+			if card, err := testreport.Card(schema, report); err != nil {
+				log.WithError(err).Warnln("cannot encode test summary card")
+			} else if err := e.uploader.UploadCard(ctx, card, state, step.GetName()); err != nil {
+				log.WithError(err).Warnln("cannot upload test summary card")
+			}
+		}
+	}
+	for _, card := range cards {
+		if err := e.uploader.UploadCard(ctx, card.Data, state, step.GetName()); err != nil {
+			log.WithError(err).
+				WithField("card", card.Name).
+				Warnln("cannot upload card")
 		}
 	}
 
@@ -324,6 +409,73 @@ func findStep(state *pipeline.State, name string) *drone.Step {
 	panic("step not found: " + name)
 }
 
+// helper function returns the test results parsed from the
+// test reports extracted from the step output, and the test
+// reports declared in the step workspace. If the step does
+// not report test results, a nil value is returned.
+func (e *Execer) collectTests(ctx context.Context, spec Spec, step Step, ext *extractor.Writer) *pipeline.TestReport {
+	log := logger.FromContext(ctx)
+
+	var result *pipeline.TestReport
+	merge := func(format string, data []byte) {
+		report, err := testreport.Parse(format, data)
+		if err != nil {
+			log.WithError(err).Warnln("cannot parse test report")
+			return
+		}
+		if result == nil {
+			result = new(pipeline.TestReport)
+		}
+		testreport.Merge(result, report)
+	}
+
+	for _, report := range ext.Reports() {
+		merge(report.Format, report.Data)
+	}
+
+	var paths []string
+	if reporter, ok := step.(TestReporter); ok {
+		paths = reporter.GetTestReports()
+	}
+	if len(paths) == 0 {
+		return result
+	}
+	opener, ok := e.engine.(FileOpener)
+	if !ok {
+		log.Warnln("cannot read test reports from the workspace")
+		return result
+	}
+	for _, path := range paths {
+		data, err := readFile(ctx, opener, spec, step, path)
+		if err != nil {
+			log.WithError(err).
+				WithField("path", path).
+				Warnln("cannot read test report")
+			continue
+		}
+		merge("", data)
+	}
+	return result
+}
+
+// helper function reads the named file from the step
+// workspace, up to the maximum test report size.
+func readFile(ctx context.Context, opener FileOpener, spec Spec, step Step, path string) ([]byte, error) {
+	rc, err := opener.OpenFile(ctx, spec, step, path)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(rc, maxReportSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxReportSize {
+		return nil, fmt.Errorf("test report exceeds the size limit of %d bytes", maxReportSize)
+	}
+	return data, nil
+}
+
 // helper function returns an array of secrets from the
 // pipeline step.
 func secretSlice(step Step) []Secret {
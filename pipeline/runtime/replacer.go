@@ -5,25 +5,90 @@
 package runtime
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"io"
+	"net/url"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
+
+	"github.com/drone/runner-go/pipeline"
 )
 
+// masked replaces sensitive data in the output.
+var masked = []byte("******")
+
+// maximum number of bytes buffered while waiting for a
+// newline before the redaction patterns are applied.
+const maxRedactBuffer = 65536
+
+// minimum length of an encoded secret, which avoids masking
+// short fragments of encoded secrets.
+const minEncodedLen = 4
+
+// minimum length of a secret for which the base64 fragments
+// are masked. The fragments of a shorter secret are too short
+// to distinguish from unrelated base64 output.
+const minFragmentLen = 8
+
 // replacer is an io.Writer that finds and masks sensitive data.
+//
+// Output is buffered until the replacer can determine that the
+// output does not end with a partial secret, which ensures a
+// secret split across multiple writes is masked. A secret never
+// contains a newline, so the buffered output is flushed at each
+// newline, and no more than the length of the longest secret is
+// buffered. The remaining output is flushed on close.
 type replacer struct {
+	sync.Mutex
+
 	w io.WriteCloser
-	r *strings.Replacer
+
+	// secrets indexed by the first byte, sorted by length
+	// in descending order.
+	secrets [256][]string
+
+	// buffered output, by stream.
+	buf map[pipeline.Stream][]byte
+
+	// redaction patterns applied to each line, and the
+	// buffered partial lines, by stream.
+	patterns []*regexp.Regexp
+	lines    map[pipeline.Stream][]byte
 }
 
-// newReplacer returns a replacer that wraps io.Writer w.
-func newReplacer(w io.WriteCloser, secrets []Secret) io.WriteCloser {
-	var oldnew []string
+// newReplacer returns a replacer that wraps io.Writer w. The
+// replacer masks the secrets and common encodings of the
+// secrets, and redacts output matching the patterns.
+func newReplacer(w io.WriteCloser, secrets []Secret, patterns ...*regexp.Regexp) io.WriteCloser {
+	r := &replacer{
+		w:        w,
+		buf:      map[pipeline.Stream][]byte{},
+		patterns: patterns,
+		lines:    map[pipeline.Stream][]byte{},
+	}
+	found := len(patterns) != 0
+	add := func(s string) {
+		r.secrets[s[0]] = append(r.secrets[s[0]], s)
+		found = true
+	}
 	for _, secret := range secrets {
 		v := secret.GetValue()
 		if len(v) == 0 || secret.IsMasked() == false {
 			continue
 		}
 
+		// a multi-line secret is often encoded as a single
+		// line, for example, a json-escaped private key.
+		if v = strings.TrimSpace(v); strings.Contains(v, "\n") {
+			for _, encoded := range encodings(v) {
+				add(encoded)
+			}
+		}
+
 		for _, part := range strings.Split(v, "\n") {
 			part = strings.TrimSpace(part)
 
@@ -33,28 +98,233 @@ func newReplacer(w io.WriteCloser, secrets []Secret) io.WriteCloser {
 				continue
 			}
 
-			masked := "******"
-			oldnew = append(oldnew, part)
-			oldnew = append(oldnew, masked)
+			add(part)
+			for _, encoded := range encodings(part) {
+				add(encoded)
+			}
 		}
 	}
-	if len(oldnew) == 0 {
+	if !found {
 		return w
 	}
-	return &replacer{
-		w: w,
-		r: strings.NewReplacer(oldnew...),
+	for _, parts := range r.secrets {
+		sort.SliceStable(parts, func(i, j int) bool {
+			return len(parts[i]) > len(parts[j])
+		})
 	}
+	return r
 }
 
 // Write writes p to the base writer. The method scans for any
 // sensitive data in p and masks before writing.
 func (r *replacer) Write(p []byte) (n int, err error) {
-	_, err = r.w.Write([]byte(r.r.Replace(string(p))))
-	return len(p), err
+	return r.write("", p)
 }
 
-// Close closes the base writer.
+// WriteStream writes p from the named stream to the base
+// writer. The method scans for any sensitive data in p and
+// masks before writing.
+func (r *replacer) WriteStream(stream pipeline.Stream, p []byte) (n int, err error) {
+	return r.write(stream, p)
+}
+
+// Close flushes the buffered output and closes the base
+// writer.
 func (r *replacer) Close() error {
-	return r.w.Close()
+	r.Lock()
+	streams := map[pipeline.Stream]struct{}{}
+	for stream := range r.buf {
+		streams[stream] = struct{}{}
+	}
+	for stream := range r.lines {
+		streams[stream] = struct{}{}
+	}
+	var sorted []string
+	for stream := range streams {
+		sorted = append(sorted, string(stream))
+	}
+	sort.Strings(sorted)
+
+	var result error
+	for _, name := range sorted {
+		stream := pipeline.Stream(name)
+		out, _ := r.mask(r.buf[stream], true)
+		delete(r.buf, stream)
+		if err := r.redact(stream, out, true); err != nil && result == nil {
+			result = err
+		}
+	}
+	r.Unlock()
+
+	if err := r.w.Close(); err != nil {
+		return err
+	}
+	return result
+}
+
+func (r *replacer) write(stream pipeline.Stream, p []byte) (n int, err error) {
+	r.Lock()
+	defer r.Unlock()
+
+	out, rest := r.mask(append(r.buf[stream], p...), false)
+	if len(rest) == 0 {
+		delete(r.buf, stream)
+	} else {
+		r.buf[stream] = append([]byte(nil), rest...)
+	}
+	return len(p), r.redact(stream, out, false)
+}
+
+// redact applies the redaction patterns to each line of the
+// masked output and writes the output to the base writer. A
+// partial line is buffered until the line is complete, the
+// buffer is full, or final is true.
+func (r *replacer) redact(stream pipeline.Stream, p []byte, final bool) error {
+	if len(r.patterns) == 0 {
+		if len(p) == 0 {
+			return nil
+		}
+		_, err := r.emit(stream, p)
+		return err
+	}
+
+	data := append(r.lines[stream], p...)
+	n := bytes.LastIndexByte(data, '\n') + 1
+	if final || len(data)-n > maxRedactBuffer {
+		n = len(data)
+	}
+	if n == len(data) {
+		delete(r.lines, stream)
+	} else {
+		r.lines[stream] = append([]byte(nil), data[n:]...)
+	}
+	if n == 0 {
+		return nil
+	}
+
+	out := data[:n]
+	for _, pattern := range r.patterns {
+		out = pattern.ReplaceAll(out, masked)
+	}
+	_, err := r.emit(stream, out)
+	return err
+}
+
+// emit writes the masked output to the base writer.
+func (r *replacer) emit(stream pipeline.Stream, p []byte) (int, error) {
+	if stream == "" {
+		return r.w.Write(p)
+	}
+	return pipeline.WriteStream(r.w, stream, p)
+}
+
+// mask returns the masked output, and the remaining output
+// that may contain a partial secret and must be buffered
+// until more output is written. If final is true, the
+// output is masked in full.
+func (r *replacer) mask(p []byte, final bool) (out, rest []byte) {
+	out = make([]byte, 0, len(p))
+	for i := 0; i < len(p); {
+		candidates := r.secrets[p[i]]
+		if len(candidates) == 0 {
+			out = append(out, p[i])
+			i++
+			continue
+		}
+		remain := p[i:]
+		if !final && partial(candidates, remain) {
+			return out, remain
+		}
+		if n := match(candidates, remain); n != 0 {
+			out = append(out, masked...)
+			i += n
+			continue
+		}
+		out = append(out, p[i])
+		i++
+	}
+	return out, nil
+}
+
+// helper function returns the length of the longest secret
+// that prefixes p, or zero if no secret prefixes p.
+func match(secrets []string, p []byte) int {
+	for _, secret := range secrets {
+		if len(secret) <= len(p) && string(p[:len(secret)]) == secret {
+			return len(secret)
+		}
+	}
+	return 0
+}
+
+// helper function returns true if p is the prefix of a
+// secret, and may be completed by subsequent output.
+func partial(secrets []string, p []byte) bool {
+	for _, secret := range secrets {
+		if len(secret) > len(p) && secret[:len(p)] == string(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function returns common encodings of the secret,
+// including json and url escaping and base64 encoding.
+func encodings(s string) []string {
+	var out []string
+	seen := map[string]bool{s: true}
+	add := func(v string) {
+		if len(v) >= minEncodedLen && !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+
+	if b, err := json.Marshal(s); err == nil {
+		add(string(b[1 : len(b)-1]))
+	}
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err == nil {
+		b := bytes.TrimSpace(buf.Bytes())
+		add(string(b[1 : len(b)-1]))
+	}
+
+	add(url.QueryEscape(s))
+	add(url.PathEscape(s))
+
+	for _, encoding := range []*base64.Encoding{
+		base64.StdEncoding,
+		base64.URLEncoding,
+	} {
+		add(encoding.EncodeToString([]byte(s)))
+		if len(s) < minFragmentLen {
+			continue
+		}
+		for offset := 0; offset < 3; offset++ {
+			add(base64Fragment(encoding, s, offset))
+		}
+	}
+	return out
+}
+
+// helper function returns the base64 encoding of the secret
+// when the secret is encoded at the byte offset of a larger
+// value, for example, a password in the base64 encoded
+// docker credentials. The encoded characters that depend on
+// the surrounding bytes are omitted.
+func base64Fragment(encoding *base64.Encoding, s string, offset int) string {
+	b := make([]byte, offset+len(s))
+	copy(b[offset:], s)
+	e := strings.TrimRight(encoding.EncodeToString(b), "=")
+	start := []int{0, 2, 3}[offset]
+	end := len(e)
+	if len(b)%3 != 0 {
+		end--
+	}
+	if start >= end {
+		return ""
+	}
+	return e[start:end]
 }
@@ -13,6 +13,7 @@ import (
 
 	"github.com/drone/runner-go/client"
 	"github.com/drone/runner-go/environ"
+	"github.com/drone/runner-go/environ/provider"
 	"github.com/drone/runner-go/logger"
 	"github.com/drone/runner-go/manifest"
 	"github.com/drone/runner-go/pipeline"
@@ -34,6 +35,12 @@ type Runner struct {
 	// be interpolated into the yaml using bash substitution.
 	Environ map[string]string
 
+	// EnvProvider is an optional provider of environment
+	// variables that are injected into each pipeline step.
+	// Masked variables are masked in the logs like secrets,
+	// and are not available for bash substitution.
+	EnvProvider provider.Provider
+
 	// Client is the remote client responsible for interacting
 	// with the central server.
 	Client client.Client
@@ -63,6 +70,11 @@ type Runner struct {
 	// Lookup is a helper function that extracts the resource
 	// from the manifest by name.
 	Lookup func(string, *manifest.Manifest) (manifest.Resource, error)
+
+	// Resolver is an optional resolver that provides the
+	// contents of files included by the configuration file.
+	// Included files are ignored if the resolver is nil.
+	Resolver manifest.Resolver
 }
 
 // Run runs the pipeline stage.
@@ -163,7 +175,39 @@ func (s *Runner) run(ctx context.Context, stage *drone.Stage, data *client.Conte
 		}
 	}()
 
+	state := &pipeline.State{
+		Build:  data.Build,
+		Stage:  stage,
+		Repo:   data.Repo,
+		System: data.System,
+	}
+
+	// evaluates whether or not the agent can process the
+	// pipeline. An agent may choose to reject a repository
+	// or build for security reasons.
+	if s.Match != nil && s.Match(data.Repo, data.Build) == false {
+		log.Error("cannot process stage, access denied")
+		state.FailAll(errors.New("insufficient permission to run the pipeline"))
+		return s.Reporter.ReportStage(noContext, state)
+	}
+
+	// list the environment variables from the provider.
+	var vars []*provider.Variable
+	if s.EnvProvider != nil {
+		var err error
+		vars, err = s.EnvProvider.List(ctx, &provider.Request{
+			Repo:  data.Repo,
+			Build: data.Build,
+		})
+		if err != nil {
+			log.WithError(err).Error("cannot list environment variables")
+			state.FailAll(err)
+			return s.Reporter.ReportStage(noContext, state)
+		}
+	}
+
 	envs := environ.Combine(
+		provider.ToMap(provider.FilterUnmasked(vars)),
 		s.Environ,
 		environ.System(data.System),
 		environ.Repo(data.Repo),
@@ -184,22 +228,6 @@ func (s *Runner) run(ctx context.Context, stage *drone.Stage, data *client.Conte
 		return v
 	}
 
-	state := &pipeline.State{
-		Build:  data.Build,
-		Stage:  stage,
-		Repo:   data.Repo,
-		System: data.System,
-	}
-
-	// evaluates whether or not the agent can process the
-	// pipeline. An agent may choose to reject a repository
-	// or build for security reasons.
-	if s.Match != nil && s.Match(data.Repo, data.Build) == false {
-		log.Error("cannot process stage, access denied")
-		state.FailAll(errors.New("insufficient permission to run the pipeline"))
-		return s.Reporter.ReportStage(noContext, state)
-	}
-
 	// evaluates string replacement expressions and returns an
 	// update configuration file string.
 	config, err := envsubst.Eval(string(data.Config.Data), subf)
@@ -210,7 +238,9 @@ func (s *Runner) run(ctx context.Context, stage *drone.Stage, data *client.Conte
 	}
 
 	// parse the yaml configuration file.
-	manifest, err := manifest.ParseString(config)
+	manifest, err := manifest.ParseString(config,
+		manifest.WithResolver(s.Resolver),
+	)
 	if err != nil {
 		log.WithError(err).Error("cannot parse configuration file")
 		state.FailAll(err)
@@ -261,6 +291,18 @@ func (s *Runner) run(ctx context.Context, stage *drone.Stage, data *client.Conte
 		if src.GetRunPolicy() == RunNever {
 			continue
 		}
+
+		// the provider environment variables are injected
+		// into the step, and do not override the step
+		// environment variables.
+		if len(vars) != 0 {
+			src.SetEnviron(
+				environ.Combine(
+					provider.ToMap(vars),
+					src.GetEnviron(),
+				),
+			)
+		}
 		stage.Steps = append(stage.Steps, &drone.Step{
 			Name:      src.GetName(),
 			Number:    len(stage.Steps) + 1,
@@ -283,6 +325,7 @@ func (s *Runner) run(ctx context.Context, stage *drone.Stage, data *client.Conte
 	log.Debug("updated stage to running")
 
 	ctxlogger := logger.WithContext(ctxcancel, log)
+	ctxlogger = WithSecrets(ctxlogger, variableSlice(vars)...)
 	err = s.Exec(ctxlogger, spec, state)
 	if err != nil {
 		log.WithError(err).
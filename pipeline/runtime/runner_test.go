@@ -3,3 +3,369 @@
 // that can be found in the LICENSE file.
 
 package runtime
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+	"github.com/drone/runner-go/client/clienttest"
+	"github.com/drone/runner-go/environ/provider"
+	"github.com/drone/runner-go/manifest"
+	"github.com/drone/runner-go/pipeline"
+	"github.com/drone/runner-go/pipeline/reporter/remote"
+)
+
+func TestRunner(t *testing.T) {
+	engine := &fakeEngine{output: "hello world\n"}
+	compiler := &fakeCompiler{steps: []string{"build", "test"}}
+	runner, server, close := newTestRunner(compiler, engine, pipeline.NopUploader())
+	defer close()
+
+	result := runTestStage(t, runner, server)
+	if result == nil {
+		return
+	}
+	if got, want := result.Status, drone.StatusPassing; got != want {
+		t.Errorf("Want stage status %q, got %q", want, got)
+	}
+	if got, want := result.Machine, "localhost"; got != want {
+		t.Errorf("Want stage machine %q, got %q", want, got)
+	}
+	if got, want := len(result.Steps), 2; got != want {
+		t.Errorf("Want %d steps, got %d", want, got)
+		return
+	}
+	for _, step := range result.Steps {
+		if got, want := step.Status, drone.StatusPassing; got != want {
+			t.Errorf("Want step %s status %q, got %q", step.Name, want, got)
+		}
+		lines := server.Logs(step.ID)
+		if len(lines) != 1 || lines[0].Message != "hello world\n" {
+			t.Errorf("Want step %s logs uploaded, got %v", step.Name, lines)
+		}
+	}
+}
+
+// this test verifies that the provider environment variables
+// are injected into each step, and that masked variables are
+// masked in the logs.
+func TestRunner_EnvProvider(t *testing.T) {
+	engine := &fakeEngine{output: "token ", environ: "TOKEN"}
+	compiler := &fakeCompiler{steps: []string{"build"}}
+	runner, server, close := newTestRunner(compiler, engine, pipeline.NopUploader())
+	defer close()
+
+	runner.EnvProvider = &fakeProvider{vars: []*provider.Variable{
+		{Name: "TOKEN", Data: "correct-horse-battery-staple", Mask: true},
+	}}
+
+	result := runTestStage(t, runner, server)
+	if result == nil {
+		return
+	}
+	if got, want := len(result.Steps), 1; got != want {
+		t.Errorf("Want %d steps, got %d", want, got)
+		return
+	}
+	var out string
+	for _, line := range server.Logs(result.Steps[0].ID) {
+		out += line.Message
+	}
+	if got, want := out, "token ******\n"; got != want {
+		t.Errorf("Want masked variable in step logs %q, got %q", want, got)
+	}
+}
+
+// this test verifies that test reports are extracted from
+// the step output and read from the workspace, and that the
+// test results are stored in the pipeline state and uploaded
+// as a card.
+func TestRunner_TestReport(t *testing.T) {
+	tap := base64.StdEncoding.EncodeToString([]byte("1..2\nok 1 - add\nnot ok 2 - subtract\n"))
+	engine := &fakeEngine{
+		output: "\u001B]1339;tap;" + tap + "\u001B]0m\n",
+		files:  map[string]string{"report.xml": `<testsuite><testcase name="TestMul"><skipped/></testcase></testsuite>`},
+	}
+	compiler := &fakeCompiler{steps: []string{"test"}, reports: []string{"report.xml"}}
+	uploader := new(fakeUploader)
+	runner, server, close := newTestRunner(compiler, engine, uploader)
+	defer close()
+
+	reporter := remote.New(runner.Client)
+	execer := NewExecer(reporter, reporter, uploader, engine, 0)
+	execer.SetTestCardSchema("https://example.com/tests.json")
+
+	var state *pipeline.State
+	runner.Exec = func(ctx context.Context, spec Spec, s *pipeline.State) error {
+		state = s
+		return execer.Exec(ctx, spec, s)
+	}
+	if result := runTestStage(t, runner, server); result == nil {
+		return
+	}
+
+	tests := state.FindMeta("test").Tests
+	if tests == nil {
+		t.Errorf("Want test results stored in the pipeline state")
+		return
+	}
+	if tests.Passed != 1 || tests.Failed != 1 || tests.Skipped != 1 {
+		t.Errorf("Want test results merged, got %+v", tests)
+	}
+	if !strings.Contains(uploader.card, `"failures":["subtract"]`) {
+		t.Errorf("Want test summary card uploaded, got %s", uploader.card)
+	}
+}
+
+// this test verifies that the card written by the step is
+// uploaded instead of the test summary card.
+func TestRunner_TestReportCard(t *testing.T) {
+	tap := base64.StdEncoding.EncodeToString([]byte("1..1\nok 1 - add\n"))
+	card := base64.StdEncoding.EncodeToString([]byte(`{"schema":"https://example.com/card.json","data":{}}`))
+	engine := &fakeEngine{
+		output: "\u001B]1339;tap;" + tap + "\u001B]0m\n" + "\u001B]1338;" + card + "\u001B]0m\n",
+	}
+	compiler := &fakeCompiler{steps: []string{"test"}}
+	uploader := new(fakeUploader)
+	runner, server, close := newTestRunner(compiler, engine, uploader)
+	defer close()
+
+	reporter := remote.New(runner.Client)
+	execer := NewExecer(reporter, reporter, uploader, engine, 0)
+	execer.SetTestCardSchema("https://example.com/tests.json")
+	runner.Exec = execer.Exec
+
+	if result := runTestStage(t, runner, server); result == nil {
+		return
+	}
+	if got, want := uploader.count, 1; got != want {
+		t.Errorf("Want %d card uploaded, got %d", want, got)
+	}
+	if !strings.Contains(uploader.card, "card.json") {
+		t.Errorf("Want step card uploaded, got %s", uploader.card)
+	}
+}
+
+// this test verifies that a successful card upload does not
+// discard the error returned by the engine.
+func TestRunner_CardEngineError(t *testing.T) {
+	card := base64.StdEncoding.EncodeToString([]byte(`{"schema":"https://example.com/card.json","data":{}}`))
+	engine := &fakeEngine{
+		output: "\u001B]1338;" + card + "\u001B]0m\n",
+		err:    errors.New("cannot start container"),
+	}
+	compiler := &fakeCompiler{steps: []string{"build"}}
+	uploader := new(fakeUploader)
+	runner, server, close := newTestRunner(compiler, engine, uploader)
+	defer close()
+
+	result := runTestStage(t, runner, server)
+	if result == nil {
+		return
+	}
+	if got, want := uploader.count, 1; got != want {
+		t.Errorf("Want %d card uploaded, got %d", want, got)
+	}
+	if got, want := result.Steps[0].Status, drone.StatusError; got != want {
+		t.Errorf("Want step status %q, got %q", want, got)
+	}
+	if got, want := result.Steps[0].Error, "cannot start container"; got != want {
+		t.Errorf("Want step error %q, got %q", want, got)
+	}
+}
+
+// this test verifies that the test result environment
+// variables are not injected when no step reports test
+// results.
+func TestRunner_NoTestReport(t *testing.T) {
+	engine := &fakeEngine{output: "total ", environ: "DRONE_TESTS_TOTAL"}
+	compiler := &fakeCompiler{steps: []string{"build", "test"}}
+	runner, server, close := newTestRunner(compiler, engine, pipeline.NopUploader())
+	defer close()
+
+	result := runTestStage(t, runner, server)
+	if result == nil {
+		return
+	}
+	for _, step := range result.Steps {
+		var out string
+		for _, line := range server.Logs(step.ID) {
+			out += line.Message
+		}
+		if got, want := out, "total \n"; got != want {
+			t.Errorf("Want no test results in step %s environment, got %q", step.Name, got)
+		}
+	}
+}
+
+// this test verifies that only the first card is uploaded,
+// since the server stores a single card per step.
+func TestRunner_Cards(t *testing.T) {
+	card := func(name, data string) string {
+		return "\u001B]1338;" + name + ";" + base64.StdEncoding.EncodeToString([]byte(data)) + "\u001B]0m\n"
+	}
+	engine := &fakeEngine{
+		output: card("first", `{"schema":"https://example.com/first.json","data":{}}`) +
+			card("second", `{"schema":"https://example.com/second.json","data":{}}`),
+	}
+	compiler := &fakeCompiler{steps: []string{"build"}}
+	uploader := new(fakeUploader)
+	runner, server, close := newTestRunner(compiler, engine, uploader)
+	defer close()
+
+	if result := runTestStage(t, runner, server); result == nil {
+		return
+	}
+	if got, want := uploader.count, 1; got != want {
+		t.Errorf("Want %d card uploaded, got %d", want, got)
+	}
+	if !strings.Contains(uploader.card, "first.json") {
+		t.Errorf("Want first card uploaded, got %s", uploader.card)
+	}
+}
+
+// helper function returns a runner connected to an in-memory
+// server with a single pending stage, and a function that
+// closes the server.
+func newTestRunner(compiler Compiler, engine Engine, uploader pipeline.Uploader) (*Runner, *clienttest.Server, func()) {
+	server := clienttest.NewServer()
+	ts := httptest.NewServer(server)
+	server.Enqueue(&client.Context{
+		Build:  &drone.Build{ID: 1, Number: 1},
+		Repo:   &drone.Repo{ID: 1, Timeout: 60},
+		Stage:  &drone.Stage{Name: "default", Kind: "pipeline", Type: "fake"},
+		Config: &client.File{Data: []byte("kind: pipeline\nname: default\n")},
+		System: &drone.System{},
+	})
+
+	c := client.New(ts.URL, "", false)
+	reporter := remote.New(c)
+	runner := &Runner{
+		Machine:  "localhost",
+		Client:   c,
+		Reporter: reporter,
+		Compiler: compiler,
+		Exec:     NewExecer(reporter, reporter, uploader, engine, 0).Exec,
+		Lint:     func(manifest.Resource, *drone.Repo) error { return nil },
+		Lookup:   func(string, *manifest.Manifest) (manifest.Resource, error) { return nil, nil },
+	}
+	return runner, server, ts.Close
+}
+
+// helper function requests and runs the pending stage, and
+// returns the stage result, or nil if the stage cannot run.
+func runTestStage(t *testing.T, runner *Runner, server *clienttest.Server) *drone.Stage {
+	stage, err := runner.Client.Request(noContext, &client.Filter{Kind: "pipeline", Type: "fake"})
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	if err := runner.Run(noContext, stage); err != nil {
+		t.Error(err)
+		return nil
+	}
+	result, _ := server.Wait(stage.ID, time.Second)
+	return result
+}
+
+//
+// fake pipeline implementation.
+//
+
+type fakeCompiler struct {
+	steps   []string
+	reports []string
+}
+
+func (c *fakeCompiler) Compile(context.Context, CompilerArgs) Spec {
+	spec := new(fakeSpec)
+	for _, name := range c.steps {
+		spec.steps = append(spec.steps, &fakeStep{name: name, reports: c.reports})
+	}
+	return spec
+}
+
+type fakeSpec struct {
+	steps []*fakeStep
+}
+
+func (s *fakeSpec) StepAt(i int) Step { return s.steps[i] }
+func (s *fakeSpec) StepLen() int      { return len(s.steps) }
+
+type fakeStep struct {
+	name    string
+	environ map[string]string
+	reports []string
+}
+
+func (s *fakeStep) GetName() string                  { return s.name }
+func (s *fakeStep) GetDependencies() []string        { return nil }
+func (s *fakeStep) GetEnviron() map[string]string    { return s.environ }
+func (s *fakeStep) SetEnviron(env map[string]string) { s.environ = env }
+func (s *fakeStep) GetErrPolicy() ErrPolicy          { return ErrFail }
+func (s *fakeStep) GetRunPolicy() RunPolicy          { return RunOnSuccess }
+func (s *fakeStep) GetSecretAt(int) Secret           { return nil }
+func (s *fakeStep) GetSecretLen() int                { return 0 }
+func (s *fakeStep) IsDetached() bool                 { return false }
+func (s *fakeStep) GetImage() string                 { return "" }
+func (s *fakeStep) GetTestReports() []string         { return s.reports }
+func (s *fakeStep) Clone() Step {
+	out := *s
+	return &out
+}
+
+type fakeEngine struct {
+	output  string
+	environ string
+	files   map[string]string
+	err     error
+}
+
+func (e *fakeEngine) Setup(context.Context, Spec) error   { return nil }
+func (e *fakeEngine) Destroy(context.Context, Spec) error { return nil }
+func (e *fakeEngine) Run(ctx context.Context, spec Spec, step Step, w io.Writer) (*State, error) {
+	io.WriteString(w, e.output)
+	if e.environ != "" {
+		io.WriteString(w, step.GetEnviron()[e.environ]+"\n")
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return &State{Exited: true}, nil
+}
+
+type fakeProvider struct {
+	vars []*provider.Variable
+}
+
+func (p *fakeProvider) List(context.Context, *provider.Request) ([]*provider.Variable, error) {
+	return p.vars, nil
+}
+
+func (e *fakeEngine) OpenFile(ctx context.Context, spec Spec, step Step, path string) (io.ReadCloser, error) {
+	data, ok := e.files[path]
+	if !ok {
+		return nil, errors.New("file not found")
+	}
+	return ioutil.NopCloser(strings.NewReader(data)), nil
+}
+
+type fakeUploader struct {
+	card  string
+	count int
+}
+
+func (u *fakeUploader) UploadCard(ctx context.Context, card []byte, state *pipeline.State, step string) error {
+	u.card = string(card)
+	u.count++
+	return nil
+}
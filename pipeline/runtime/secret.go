@@ -0,0 +1,49 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+
+	"github.com/drone/runner-go/environ/provider"
+)
+
+type secretsKey struct{}
+
+// WithSecrets returns a new context with the secrets. The
+// secrets are masked in the output of every pipeline step, in
+// addition to the secrets attached to each step.
+func WithSecrets(ctx context.Context, secrets ...Secret) context.Context {
+	// the parent slice is copied so that sibling contexts
+	// derived from the same parent do not share an array.
+	secrets = append(append([]Secret(nil), SecretsFrom(ctx)...), secrets...)
+	return context.WithValue(ctx, secretsKey{}, secrets)
+}
+
+// SecretsFrom returns the secrets from the context.
+func SecretsFrom(ctx context.Context) []Secret {
+	secrets, _ := ctx.Value(secretsKey{}).([]Secret)
+	return secrets
+}
+
+// variable adapts an environment variable to the Secret
+// interface.
+type variable struct {
+	*provider.Variable
+}
+
+func (v *variable) GetName() string  { return v.Name }
+func (v *variable) GetValue() string { return v.Data }
+func (v *variable) IsMasked() bool   { return v.Mask }
+
+// helper function returns an array of secrets from the
+// masked environment variables.
+func variableSlice(vars []*provider.Variable) []Secret {
+	var secrets []Secret
+	for _, v := range provider.FilterMasked(vars) {
+		secrets = append(secrets, &variable{v})
+	}
+	return secrets
+}
@@ -0,0 +1,29 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"testing"
+)
+
+// this test verifies that contexts derived from the same
+// parent do not overwrite each other's secrets.
+func TestWithSecrets_Siblings(t *testing.T) {
+	parent := WithSecrets(context.Background(), &mockSecret{Name: "a"}, &mockSecret{Name: "b"})
+	parent = WithSecrets(parent, &mockSecret{Name: "c"})
+	ctx1 := WithSecrets(parent, &mockSecret{Name: "d"})
+	ctx2 := WithSecrets(parent, &mockSecret{Name: "e"})
+
+	if got, want := len(SecretsFrom(parent)), 3; got != want {
+		t.Errorf("Want %d parent secrets, got %d", want, got)
+	}
+	if got, want := SecretsFrom(ctx1)[3].GetName(), "d"; got != want {
+		t.Errorf("Want secret %q, got %q", want, got)
+	}
+	if got, want := SecretsFrom(ctx2)[3].GetName(), "e"; got != want {
+		t.Errorf("Want secret %q, got %q", want, got)
+	}
+}
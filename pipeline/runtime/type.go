@@ -86,6 +86,13 @@ type (
 		Run(context.Context, Spec, Step, io.Writer) (*State, error)
 	}
 
+	// FileOpener is an optional interface implemented by an
+	// Engine that can read files from the step workspace.
+	FileOpener interface {
+		// OpenFile opens the named file in the step workspace.
+		OpenFile(context.Context, Spec, Step, string) (io.ReadCloser, error)
+	}
+
 	// Spec is an interface that must be implemented by all
 	// pipeline specifications.
 	Spec interface {
@@ -136,6 +143,14 @@ type (
 		GetImage() string
 	}
 
+	// TestReporter is an optional interface implemented by
+	// a Step that declares test reports in the workspace.
+	TestReporter interface {
+		// GetTestReports returns the paths of the test
+		// reports in the step workspace.
+		GetTestReports() []string
+	}
+
 	// State reports the step state.
 	State struct {
 		// ExitCode returns the exit code of the exited step.
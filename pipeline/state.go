@@ -19,6 +19,35 @@ type State struct {
 	Repo   *drone.Repo
 	Stage  *drone.Stage
 	System *drone.System
+
+	// Meta stores the step metadata, keyed by step name.
+	Meta map[string]*Meta
+}
+
+// Meta stores step metadata collected during execution
+// that is not part of the step status.
+type Meta struct {
+	// LogTruncated is the number of lines truncated from
+	// the step log because the log exceeded the limit.
+	LogTruncated int `json:"log_truncated,omitempty"`
+
+	// Tests stores the test results reported by the step.
+	Tests *TestReport `json:"tests,omitempty"`
+}
+
+// TestReport stores aggregated test results.
+type TestReport struct {
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+
+	// Failures lists the names of the failed tests.
+	Failures []string `json:"failures,omitempty"`
+}
+
+// Total returns the total number of tests.
+func (r *TestReport) Total() int {
+	return r.Passed + r.Failed + r.Skipped
 }
 
 // Cancel cancels the pipeline.
@@ -123,6 +152,51 @@ func (s *State) Find(name string) *drone.Step {
 	return v
 }
 
+// FindMeta returns a copy of the named step metadata.
+func (s *State) FindMeta(name string) Meta {
+	s.Lock()
+	defer s.Unlock()
+	if v, ok := s.Meta[name]; ok {
+		return *v
+	}
+	return Meta{}
+}
+
+// UpdateMeta updates the named step metadata.
+func (s *State) UpdateMeta(name string, fn func(*Meta)) {
+	s.Lock()
+	defer s.Unlock()
+	if s.Meta == nil {
+		s.Meta = map[string]*Meta{}
+	}
+	v, ok := s.Meta[name]
+	if !ok {
+		v = new(Meta)
+		s.Meta[name] = v
+	}
+	fn(v)
+}
+
+// Tests returns the test results aggregated across all steps
+// that reported test results, and false if no step reported
+// test results. The failed test names are not included in the
+// aggregated results.
+func (s *State) Tests() (TestReport, bool) {
+	s.Lock()
+	defer s.Unlock()
+	var r TestReport
+	var ok bool
+	for _, v := range s.Meta {
+		if v.Tests != nil {
+			r.Passed += v.Tests.Passed
+			r.Failed += v.Tests.Failed
+			r.Skipped += v.Tests.Skipped
+			ok = true
+		}
+	}
+	return r, ok
+}
+
 //
 // Helper functions. INTERNAL USE ONLY
 //
@@ -154,3 +154,43 @@ func TestStateFind(t *testing.T) {
 
 	state.find("test")
 }
+
+func TestStateMeta(t *testing.T) {
+	state := new(State)
+	if got := state.FindMeta("clone"); got.LogTruncated != 0 {
+		t.Errorf("Expect empty metadata")
+	}
+	state.UpdateMeta("clone", func(meta *Meta) {
+		meta.LogTruncated = 10
+	})
+	if got, want := state.FindMeta("clone").LogTruncated, 10; got != want {
+		t.Errorf("Want %d truncated lines, got %d", want, got)
+	}
+}
+
+func TestStateTests(t *testing.T) {
+	state := new(State)
+	state.UpdateMeta("clone", func(meta *Meta) {
+		meta.LogTruncated = 10
+	})
+	if _, ok := state.Tests(); ok {
+		t.Errorf("Expect no test results before a step reports test results")
+	}
+	state.UpdateMeta("test", func(meta *Meta) {
+		meta.Tests = &TestReport{Passed: 3, Failed: 1, Failures: []string{"TestFoo"}}
+	})
+	state.UpdateMeta("integration", func(meta *Meta) {
+		meta.Tests = &TestReport{Passed: 2, Skipped: 1}
+	})
+
+	got, ok := state.Tests()
+	if !ok {
+		t.Errorf("Expect test results")
+	}
+	if got.Passed != 5 || got.Failed != 1 || got.Skipped != 1 {
+		t.Errorf("Want aggregated test results, got %+v", got)
+	}
+	if got, want := got.Total(), 7; got != want {
+		t.Errorf("Want %d total tests, got %d", want, got)
+	}
+}
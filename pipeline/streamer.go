@@ -16,6 +16,35 @@ type Streamer interface {
 	Stream(context.Context, *State, string) io.WriteCloser
 }
 
+// Stream identifies the output stream of a pipeline step.
+type Stream string
+
+// Output streams.
+const (
+	Stdout Stream = "stdout"
+	Stderr Stream = "stderr"
+)
+
+// A StreamWriter is an io.Writer that accepts output tagged
+// with the stream. Engines can type assert the io.Writer
+// passed to the step to label stdout and stderr output.
+type StreamWriter interface {
+	io.Writer
+
+	// WriteStream writes output from the named stream.
+	WriteStream(Stream, []byte) (int, error)
+}
+
+// WriteStream writes output from the named stream to w. If w
+// does not implement StreamWriter the stream is discarded
+// and the output is written to w.
+func WriteStream(w io.Writer, stream Stream, p []byte) (int, error) {
+	if sw, ok := w.(StreamWriter); ok {
+		return sw.WriteStream(stream, p)
+	}
+	return w.Write(p)
+}
+
 // NopStreamer returns a noop streamer.
 func NopStreamer() Streamer {
 	return new(nopStreamer)
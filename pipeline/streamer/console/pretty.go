@@ -7,11 +7,16 @@ package console
 import (
 	"fmt"
 	"io"
+
+	"github.com/drone/runner-go/pipeline"
 )
 
 // pretty line format with line number and coloring.
 const prettyf = "\033[%s[%s:%d]\033[0m %s\n"
 
+// pretty line format for stderr, with the line colored red.
+const prettyErrf = "\033[%s[%s:%d]\033[0m \033[31m%s\033[0m\n"
+
 // available terminal colors
 var colors = []string{
 	"32m", // green
@@ -35,6 +40,16 @@ func (w *pretty) Write(b []byte) (int, error) {
 	return len(b), nil
 }
 
+func (w *pretty) WriteStream(stream pipeline.Stream, b []byte) (int, error) {
+	if stream != pipeline.Stderr {
+		return w.Write(b)
+	}
+	for _, part := range split(b) {
+		fmt.Fprintf(w.base, prettyErrf, w.color, w.name, w.seq.next(), part)
+	}
+	return len(b), nil
+}
+
 func (w *pretty) Close() error {
 	return nil
 }
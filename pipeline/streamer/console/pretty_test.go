@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"testing"
 
+	"github.com/drone/runner-go/pipeline"
 	"github.com/google/go-cmp/cmp"
 )
 
@@ -26,3 +27,20 @@ func TestPretty(t *testing.T) {
 		t.Log(diff)
 	}
 }
+
+func TestPrettyStderr(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	sess := New(true)
+	w := sess.Stream(nil, nil, "clone").(*pretty)
+	w.base = buf
+	w.WriteStream(pipeline.Stderr, []byte("hello"))
+	w.WriteStream(pipeline.Stdout, []byte("world"))
+	w.Close()
+
+	got, want := buf.String(), "\x1b[33m[clone:1]\x1b[0m \x1b[31mhello\x1b[0m\n\x1b[33m[clone:2]\x1b[0m world\n"
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Invalid stderr log output")
+		t.Log(diff)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package sink
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var _ Sink = (*File)(nil)
+
+// File is a sink that writes the step logs to local files,
+// one file per step, in a directory tree organized by
+// repository, build and stage.
+type File struct {
+	// Dir is the root directory.
+	Dir string
+}
+
+// NewFile returns a sink that writes the step logs to files
+// in the directory.
+func NewFile(dir string) *File {
+	return &File{Dir: dir}
+}
+
+// Open opens the log file for the pipeline step. An existing
+// file is truncated.
+func (s *File) Open(_ context.Context, key *Key) (Log, error) {
+	path := filepath.Join(s.Dir, filepath.FromSlash(keyPath(key)))
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileLog{file: file}, nil
+}
+
+type fileLog struct {
+	file *os.File
+}
+
+func (l *fileLog) WriteLine(line *Line) error {
+	_, err := l.file.WriteString(line.Message + "\n")
+	return err
+}
+
+func (l *fileLog) Close() error {
+	return l.file.Close()
+}
+
+// keyPath returns the slash-separated relative path of the
+// step log, in the format <repo>/<build>/<stage>/<step>.log
+func keyPath(key *Key) string {
+	var parts []string
+	for _, part := range strings.Split(key.Repo, "/") {
+		parts = append(parts, clean(part))
+	}
+	parts = append(parts,
+		strconv.FormatInt(key.Build, 10),
+		strconv.Itoa(key.Stage),
+		clean(key.Step)+".log",
+	)
+	return path.Join(parts...)
+}
+
+// clean replaces characters that are not safe to use in a
+// file name.
+func clean(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z',
+			r >= 'A' && r <= 'Z',
+			r >= '0' && r <= '9',
+			r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
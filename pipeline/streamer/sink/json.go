@@ -0,0 +1,62 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+var _ Sink = (*JSON)(nil)
+
+// JSON is a sink that writes the step logs to a writer as
+// newline-delimited json. The logs of all steps are written
+// to the same writer, and each line includes the key to
+// identify the step.
+type JSON struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSON returns a sink that writes the step logs to w as
+// newline-delimited json.
+func NewJSON(w io.Writer) *JSON {
+	return &JSON{w: w}
+}
+
+// Open opens the log for the pipeline step.
+func (s *JSON) Open(_ context.Context, key *Key) (Log, error) {
+	return &jsonLog{sink: s, key: key}, nil
+}
+
+// write writes the encoded line to the writer.
+func (s *JSON) write(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+type jsonLog struct {
+	sink *JSON
+	key  *Key
+}
+
+func (l *jsonLog) WriteLine(line *Line) error {
+	return l.sink.write(struct {
+		*Key
+		*Line
+	}{l.key, line})
+}
+
+func (l *jsonLog) Close() error {
+	return nil
+}
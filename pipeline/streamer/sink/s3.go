@@ -0,0 +1,205 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package sink
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+var _ Sink = (*S3)(nil)
+
+// default S3 region.
+const defaultRegion = "us-east-1"
+
+// S3 is a sink that uploads the step logs to an S3-compatible
+// object store when the step completes. The logs are buffered
+// in a temporary file until uploaded, and requests are signed
+// with AWS Signature Version 4 if credentials are provided.
+type S3 struct {
+	// Endpoint is the object store endpoint, for example,
+	// https://s3.amazonaws.com. Objects are addressed using
+	// path-style urls.
+	Endpoint string
+
+	// Region is the bucket region. If empty, the region
+	// defaults to us-east-1.
+	Region string
+
+	// Bucket is the bucket name.
+	Bucket string
+
+	// Prefix is prepended to the object key.
+	Prefix string
+
+	// AccessKey and SecretKey are the credentials used to
+	// sign requests. If empty, requests are not signed.
+	AccessKey string
+	SecretKey string
+
+	// Client is the http client used to upload logs. If nil,
+	// the default client is used.
+	Client *http.Client
+}
+
+// Open opens the log for the pipeline step.
+func (s *S3) Open(ctx context.Context, key *Key) (Log, error) {
+	file, err := ioutil.TempFile("", "drone-log")
+	if err != nil {
+		return nil, err
+	}
+	return &s3Log{
+		ctx:  ctx,
+		sink: s,
+		key:  path.Join(s.Prefix, keyPath(key)),
+		file: file,
+	}, nil
+}
+
+// upload uploads the object to the bucket.
+func (s *S3) upload(ctx context.Context, key string, body io.ReadSeeker, size int64) error {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	endpoint := strings.TrimSuffix(s.Endpoint, "/")
+	uri := "/" + s.Bucket + "/" + key
+	req, err := http.NewRequest("PUT", endpoint+escapePath(uri), ioutil.NopCloser(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(hash.Sum(nil)))
+	if s.AccessKey != "" {
+		s.sign(req, time.Now().UTC())
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		out, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("sink: cannot upload log: %s: %s", res.Status, out)
+	}
+	return nil
+}
+
+// sign signs the request using AWS Signature Version 4. The
+// request must include the X-Amz-Content-Sha256 header.
+func (s *S3) sign(req *http.Request, now time.Time) {
+	region := s.Region
+	if region == "" {
+		region = defaultRegion
+	}
+	date := now.Format("20060102")
+	timestamp := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", timestamp)
+
+	payload := req.Header.Get("X-Amz-Content-Sha256")
+	headers := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payload + "\n" +
+		"x-amz-date:" + timestamp + "\n"
+	signed := "host;x-amz-content-sha256;x-amz-date"
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headers,
+		signed,
+		payload,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	digest := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + timestamp + "\n" + scope + "\n" +
+		hex.EncodeToString(digest[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signed, signature,
+	))
+}
+
+type s3Log struct {
+	ctx  context.Context
+	sink *S3
+	key  string
+	file *os.File
+	size int64
+}
+
+func (l *s3Log) WriteLine(line *Line) error {
+	n, err := l.file.WriteString(line.Message + "\n")
+	l.size += int64(n)
+	return err
+}
+
+// Close uploads the log to the object store and removes
+// the temporary file.
+func (l *s3Log) Close() error {
+	defer os.Remove(l.file.Name())
+	defer l.file.Close()
+	if _, err := l.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return l.sink.upload(l.ctx, l.key, l.file, l.size)
+}
+
+// helper function returns the hmac-sha256 of the data.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// helper function escapes the path using the uri encoding
+// required by the signature, where all characters other
+// than unreserved characters and the path separator are
+// percent-encoded.
+func escapePath(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z',
+			c >= 'A' && c <= 'Z',
+			c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
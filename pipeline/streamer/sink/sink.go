@@ -0,0 +1,147 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package sink provides a streamer that writes the pipeline
+// logs to a log sink, such as local files or an object store.
+package sink
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone/runner-go/logger"
+	"github.com/drone/runner-go/pipeline"
+)
+
+// A Sink stores the pipeline step logs.
+type Sink interface {
+	// Open opens the log for the pipeline step.
+	Open(context.Context, *Key) (Log, error)
+}
+
+// A Log writes the log lines of a pipeline step to the
+// sink. The log is closed when the step completes.
+type Log interface {
+	// WriteLine writes the line to the log.
+	WriteLine(*Line) error
+
+	// Close closes the log.
+	Close() error
+}
+
+// Key identifies the pipeline step log.
+type Key struct {
+	Repo  string `json:"repo"`
+	Build int64  `json:"build"`
+	Stage int    `json:"stage"`
+	Step  string `json:"step"`
+}
+
+// Line represents a line of step output.
+type Line struct {
+	Number  int             `json:"pos"`
+	Message string          `json:"out"`
+	Stream  pipeline.Stream `json:"stream,omitempty"`
+	Time    time.Time       `json:"time"`
+	Elapsed time.Duration   `json:"elapsed"`
+}
+
+var _ pipeline.Streamer = (*Streamer)(nil)
+
+// Streamer implements a pipeline streamer that writes the
+// pipeline logs to a sink.
+type Streamer struct {
+	sink Sink
+}
+
+// New returns a new streamer that writes the pipeline logs
+// to the sink.
+func New(sink Sink) *Streamer {
+	return &Streamer{sink: sink}
+}
+
+// Stream returns an io.WriteCloser that writes the step
+// output to the sink. If the log cannot be opened, the
+// error is logged and the output is discarded.
+func (s *Streamer) Stream(ctx context.Context, state *pipeline.State, name string) io.WriteCloser {
+	key := new(Key)
+	key.Step = name
+	state.Lock()
+	if state.Repo != nil {
+		key.Repo = state.Repo.Slug
+	}
+	if state.Build != nil {
+		key.Build = state.Build.Number
+	}
+	if state.Stage != nil {
+		key.Stage = state.Stage.Number
+	}
+	state.Unlock()
+
+	log, err := s.sink.Open(ctx, key)
+	if err != nil {
+		logger.FromContext(ctx).
+			WithError(err).
+			WithField("step", name).
+			Warnln("sink: cannot open log")
+		return pipeline.NopStreamer().Stream(ctx, state, name)
+	}
+	return &writer{log: log, start: time.Now()}
+}
+
+// writer is an io.WriteCloser that splits the output into
+// lines and writes the lines to the log. Errors writing to
+// the log do not interrupt the step output, and the first
+// error is returned when the writer is closed.
+type writer struct {
+	sync.Mutex
+	log   Log
+	start time.Time
+	num   int
+	err   error
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	return w.WriteStream("", p)
+}
+
+func (w *writer) WriteStream(stream pipeline.Stream, p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	now := time.Now()
+	for _, part := range split(p) {
+		err := w.log.WriteLine(&Line{
+			Number:  w.num,
+			Message: part,
+			Stream:  stream,
+			Time:    now,
+			Elapsed: now.Sub(w.start),
+		})
+		if err != nil && w.err == nil {
+			w.err = err
+		}
+		w.num++
+	}
+	return len(p), nil
+}
+
+func (w *writer) Close() error {
+	err := w.log.Close()
+	w.Lock()
+	defer w.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	return err
+}
+
+// helper function splits the output into lines, removing
+// the trailing newline.
+func split(p []byte) []string {
+	s := strings.TrimSuffix(string(p), "\n")
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/pipeline"
+)
+
+var noContext = context.Background()
+
+func testState() *pipeline.State {
+	return &pipeline.State{
+		Repo:  &drone.Repo{Slug: "octocat/hello-world"},
+		Build: &drone.Build{Number: 42},
+		Stage: &drone.Stage{Number: 1},
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := New(NewFile(dir)).Stream(noContext, testState(), "go build")
+	w.Write([]byte("hello\nworld\n"))
+	if err := w.Close(); err != nil {
+		t.Error(err)
+	}
+
+	out, err := ioutil.ReadFile(filepath.Join(dir, "octocat", "hello-world", "42", "1", "go_build.log"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := string(out), "hello\nworld\n"; got != want {
+		t.Errorf("Want log %q, got %q", want, got)
+	}
+}
+
+func TestKeyPath(t *testing.T) {
+	key := &Key{Repo: "../octocat", Build: 1, Stage: 2, Step: ".."}
+	if got, want := keyPath(key), "_/octocat/1/2/_.log"; got != want {
+		t.Errorf("Want path %q, got %q", want, got)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := New(NewJSON(buf)).Stream(noContext, testState(), "build")
+	w.Write([]byte("hello\n"))
+	pipeline.WriteStream(w, pipeline.Stderr, []byte("world\n"))
+	w.Close()
+
+	dec := json.NewDecoder(buf)
+	var lines []map[string]interface{}
+	for dec.More() {
+		line := map[string]interface{}{}
+		if err := dec.Decode(&line); err != nil {
+			t.Error(err)
+			return
+		}
+		lines = append(lines, line)
+	}
+	if got, want := len(lines), 2; got != want {
+		t.Errorf("Want %d lines, got %d", want, got)
+		return
+	}
+	if got, want := lines[0]["repo"], "octocat/hello-world"; got != want {
+		t.Errorf("Want repo %q, got %v", want, got)
+	}
+	if got, want := lines[0]["step"], "build"; got != want {
+		t.Errorf("Want step %q, got %v", want, got)
+	}
+	if got, want := lines[1]["out"], "world"; got != want {
+		t.Errorf("Want message %q, got %v", want, got)
+	}
+	if got, want := lines[1]["stream"], "stderr"; got != want {
+		t.Errorf("Want stream %q, got %v", want, got)
+	}
+	if got, want := lines[1]["pos"], float64(1); got != want {
+		t.Errorf("Want line number %v, got %v", want, got)
+	}
+}
+
+func TestStream_Error(t *testing.T) {
+	w := New(&mockSink{err: errors.New("oops")}).Stream(noContext, testState(), "build")
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Errorf("Expect write error does not interrupt output")
+	}
+	if err := w.Close(); err == nil {
+		t.Errorf("Expect write error returned on close")
+	}
+}
+
+type mockSink struct {
+	err error
+}
+
+func (m *mockSink) Open(context.Context, *Key) (Log, error) {
+	return m, nil
+}
+
+func (m *mockSink) WriteLine(*Line) error { return m.err }
+func (m *mockSink) Close() error          { return nil }
@@ -0,0 +1,165 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/drone/runner-go/pipeline"
+)
+
+var _ Sink = (*Syslog)(nil)
+
+// syslog priorities, using the user facility.
+const (
+	syslogInfo = 1<<3 | 6
+	syslogErr  = 1<<3 | 3
+)
+
+// default syslog socket paths.
+var syslogPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// default syslog tag.
+const defaultSyslogTag = "drone"
+
+// Syslog is a sink that writes the step logs to the syslog
+// daemon over a local socket. Lines written to stderr are
+// logged with error severity, and all other lines with
+// informational severity.
+type Syslog struct {
+	// Network is the socket network, unixgram or unix. If
+	// empty, unixgram and unix are attempted in order.
+	Network string
+
+	// Addr is the socket path. If empty, the default socket
+	// paths are attempted in order.
+	Addr string
+
+	// Tag is the syslog tag. If empty, the tag defaults
+	// to drone.
+	Tag string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	stream bool
+}
+
+// NewSyslog returns a sink that writes the step logs to the
+// syslog daemon listening on the local socket.
+func NewSyslog(network, addr, tag string) *Syslog {
+	return &Syslog{
+		Network: network,
+		Addr:    addr,
+		Tag:     tag,
+	}
+}
+
+// Open opens the log for the pipeline step.
+func (s *Syslog) Open(_ context.Context, key *Key) (Log, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return &syslogLog{sink: s, key: key}, nil
+}
+
+// Close closes the connection to the syslog daemon.
+func (s *Syslog) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// write writes the message to the syslog daemon. If the
+// write fails, the connection is re-established and the
+// write is retried once.
+func (s *Syslog) write(priority int, timestamp time.Time, msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for i := 0; i < 2; i++ {
+		if err = s.connect(); err != nil {
+			continue
+		}
+		line := fmt.Sprintf("<%d>%s %s[%d]: %s",
+			priority, timestamp.Format(time.Stamp), s.tag(), os.Getpid(), msg)
+		if s.stream {
+			line = line + "\n"
+		}
+		if _, err = s.conn.Write([]byte(line)); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+// connect connects to the syslog daemon if not connected.
+// The caller must hold the lock.
+func (s *Syslog) connect() error {
+	if s.conn != nil {
+		return nil
+	}
+	networks := []string{"unixgram", "unix"}
+	if s.Network != "" {
+		networks = []string{s.Network}
+	}
+	paths := syslogPaths
+	if s.Addr != "" {
+		paths = []string{s.Addr}
+	}
+	for _, network := range networks {
+		for _, path := range paths {
+			conn, err := net.Dial(network, path)
+			if err == nil {
+				s.conn = conn
+				s.stream = network != "unixgram"
+				return nil
+			}
+		}
+	}
+	return errors.New("sink: cannot connect to the syslog daemon")
+}
+
+// tag returns the syslog tag.
+func (s *Syslog) tag() string {
+	if s.Tag == "" {
+		return defaultSyslogTag
+	}
+	return s.Tag
+}
+
+type syslogLog struct {
+	sink *Syslog
+	key  *Key
+}
+
+func (l *syslogLog) WriteLine(line *Line) error {
+	priority := syslogInfo
+	if line.Stream == pipeline.Stderr {
+		priority = syslogErr
+	}
+	msg := fmt.Sprintf("[%s#%d:%d:%s] %s",
+		l.key.Repo, l.key.Build, l.key.Stage, l.key.Step, line.Message)
+	return l.sink.write(priority, line.Time, msg)
+}
+
+func (l *syslogLog) Close() error {
+	return nil
+}
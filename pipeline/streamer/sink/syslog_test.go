@@ -0,0 +1,74 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package sink
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone/runner-go/pipeline"
+)
+
+func TestSyslog(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets not supported")
+	}
+	dir, err := ioutil.TempDir("", "syslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	addr := filepath.Join(dir, "log")
+	conn, err := net.ListenPacket("unixgram", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sink := NewSyslog("unixgram", addr, "runner")
+	defer sink.Close()
+	w := New(sink).Stream(noContext, testState(), "build")
+	w.Write([]byte("hello\n"))
+	pipeline.WriteStream(w, pipeline.Stderr, []byte("world\n"))
+	w.Close()
+
+	want := []string{
+		"<14>",
+		"<11>",
+	}
+	buf := make([]byte, 1024)
+	for i, prefix := range want {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		msg := string(buf[:n])
+		if !strings.HasPrefix(msg, prefix) {
+			t.Errorf("Want message %d with priority %s, got %q", i, prefix, msg)
+		}
+		if !strings.Contains(msg, " runner[") {
+			t.Errorf("Want message tagged, got %q", msg)
+		}
+		if !strings.Contains(msg, "[octocat/hello-world#42:1:build]") {
+			t.Errorf("Want message includes the step, got %q", msg)
+		}
+	}
+}
+
+func TestSyslog_Unavailable(t *testing.T) {
+	sink := NewSyslog("unixgram", filepath.Join(os.TempDir(), "does-not-exist"), "")
+	if _, err := sink.Open(noContext, new(Key)); err == nil {
+		t.Errorf("Expect error when the syslog daemon is unavailable")
+	}
+}
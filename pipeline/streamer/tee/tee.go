@@ -0,0 +1,78 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package tee provides a streamer that writes the pipeline
+// output to multiple streamers.
+package tee
+
+import (
+	"context"
+	"io"
+
+	"github.com/drone/runner-go/pipeline"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+var _ pipeline.Streamer = (*Tee)(nil)
+
+// Tee implements a pipeline streamer that writes the
+// pipeline output to multiple streamers.
+type Tee struct {
+	streamers []pipeline.Streamer
+}
+
+// New returns a new streamer that writes the pipeline output
+// to each of the streamers.
+func New(streamers ...pipeline.Streamer) *Tee {
+	return &Tee{streamers: streamers}
+}
+
+// Stream returns an io.WriteCloser that writes the step
+// output to the writers returned by each streamer.
+func (t *Tee) Stream(ctx context.Context, state *pipeline.State, name string) io.WriteCloser {
+	w := new(writer)
+	for _, streamer := range t.streamers {
+		w.writers = append(w.writers, streamer.Stream(ctx, state, name))
+	}
+	return w
+}
+
+// writer is an io.WriteCloser that writes to multiple
+// writers. The output is written to every writer, even if
+// a writer returns an error, so that a failing writer does
+// not interrupt the output written to the other writers.
+type writer struct {
+	writers []io.WriteCloser
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	var result error
+	for _, wc := range w.writers {
+		if _, err := wc.Write(p); err != nil && result == nil {
+			result = err
+		}
+	}
+	return len(p), result
+}
+
+func (w *writer) WriteStream(stream pipeline.Stream, p []byte) (int, error) {
+	var result error
+	for _, wc := range w.writers {
+		if _, err := pipeline.WriteStream(wc, stream, p); err != nil && result == nil {
+			result = err
+		}
+	}
+	return len(p), result
+}
+
+func (w *writer) Close() error {
+	var result error
+	for _, wc := range w.writers {
+		if err := wc.Close(); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	return result
+}
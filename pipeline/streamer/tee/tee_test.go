@@ -0,0 +1,73 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package tee
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/drone/runner-go/pipeline"
+)
+
+func TestTee(t *testing.T) {
+	a := &mockStreamer{}
+	b := &mockStreamer{err: errors.New("oops")}
+	c := &mockStreamer{}
+
+	w := New(a, b, c).Stream(context.Background(), nil, "build")
+	if _, err := w.Write([]byte("hello ")); err == nil {
+		t.Errorf("Expect write error returned")
+	}
+	pipeline.WriteStream(w, pipeline.Stderr, []byte("world"))
+	if err := w.Close(); err == nil {
+		t.Errorf("Expect close error returned")
+	}
+
+	for _, m := range []*mockStreamer{a, c} {
+		if got, want := m.buf.String(), "hello world"; got != want {
+			t.Errorf("Want output %q, got %q", want, got)
+		}
+		if got, want := m.stream, pipeline.Stderr; got != want {
+			t.Errorf("Want stream %q, got %q", want, got)
+		}
+		if !m.closed {
+			t.Errorf("Expect writer closed")
+		}
+	}
+	if !b.closed {
+		t.Errorf("Expect failing writer closed")
+	}
+}
+
+type mockStreamer struct {
+	buf    bytes.Buffer
+	stream pipeline.Stream
+	closed bool
+	err    error
+}
+
+func (m *mockStreamer) Stream(context.Context, *pipeline.State, string) io.WriteCloser {
+	return m
+}
+
+func (m *mockStreamer) Write(p []byte) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	return m.buf.Write(p)
+}
+
+func (m *mockStreamer) WriteStream(stream pipeline.Stream, p []byte) (int, error) {
+	m.stream = stream
+	return m.Write(p)
+}
+
+func (m *mockStreamer) Close() error {
+	m.closed = true
+	return m.err
+}
@@ -3,3 +3,32 @@
 // that can be found in the LICENSE file.
 
 package pipeline
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteStream(t *testing.T) {
+	w := new(mockStreamWriter)
+	WriteStream(w, Stderr, []byte("hello"))
+	if got, want := w.stream, Stderr; got != want {
+		t.Errorf("Want stream %q, got %q", want, got)
+	}
+
+	buf := new(bytes.Buffer)
+	WriteStream(buf, Stderr, []byte("hello"))
+	if got, want := buf.String(), "hello"; got != want {
+		t.Errorf("Want output %q written to writer, got %q", want, got)
+	}
+}
+
+type mockStreamWriter struct {
+	bytes.Buffer
+	stream Stream
+}
+
+func (m *mockStreamWriter) WriteStream(stream Stream, p []byte) (int, error) {
+	m.stream = stream
+	return m.Write(p)
+}
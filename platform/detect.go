@@ -0,0 +1,66 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package platform
+
+import (
+	"runtime"
+	"strings"
+
+	"github.com/drone/runner-go/client"
+)
+
+// Detect returns a filter populated with the operating
+// system, architecture, variant and kernel version of the
+// host machine.
+func Detect() *client.Filter {
+	filter := new(client.Filter)
+	Populate(filter)
+	return filter
+}
+
+// Populate populates the empty platform fields of the
+// filter with the values detected from the host machine.
+func Populate(filter *client.Filter) {
+	if filter.OS == "" {
+		filter.OS = runtime.GOOS
+	}
+	if filter.Arch == "" {
+		filter.Arch = runtime.GOARCH
+	}
+	if filter.Variant == "" {
+		filter.Variant = variant()
+	}
+	if filter.Kernel == "" {
+		filter.Kernel = kernel()
+	}
+}
+
+// NormalizeOS returns the normalized operating system
+// name (e.g. macos is normalized to darwin).
+func NormalizeOS(s string) string {
+	s = strings.ToLower(s)
+	switch s {
+	case "macos", "osx":
+		return "darwin"
+	}
+	return s
+}
+
+// NormalizeArch returns the normalized architecture name
+// (e.g. x86_64 is normalized to amd64).
+func NormalizeArch(s string) string {
+	s = strings.ToLower(s)
+	switch s {
+	case "x86_64", "x86-64":
+		return "amd64"
+	case "aarch64":
+		return "arm64"
+	case "i386", "i686", "x86":
+		return "386"
+	case "armhf", "armel":
+		return "arm"
+	}
+	return s
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package platform
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// kernel returns the kernel release of the host machine.
+func kernel() string {
+	var uts syscall.Utsname
+	if err := syscall.Uname(&uts); err != nil {
+		return ""
+	}
+	var b []byte
+	for _, c := range uts.Release {
+		if c == 0 {
+			break
+		}
+		b = append(b, byte(c))
+	}
+	return string(b)
+}
+
+// variant returns the architecture variant of the host
+// machine (e.g. v7 for armv7).
+func variant() string {
+	switch runtime.GOARCH {
+	case "arm64":
+		return "v8"
+	case "arm":
+	default:
+		return ""
+	}
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	return parseVariant(f)
+}
+
+// helper function parses the architecture variant from
+// the /proc/cpuinfo file.
+func parseVariant(r io.Reader) string {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if strings.TrimSpace(parts[0]) != "CPU architecture" {
+			continue
+		}
+		switch v := strings.TrimSpace(parts[1]); v {
+		case "AArch64", "8":
+			return "v8"
+		default:
+			return "v" + v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,36 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package platform
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKernel(t *testing.T) {
+	if kernel() == "" {
+		t.Errorf("Expect kernel release detected")
+	}
+}
+
+func TestParseVariant(t *testing.T) {
+	tests := []struct {
+		cpuinfo string
+		variant string
+	}{
+		{"processor\t: 0\nCPU architecture: 7\n", "v7"},
+		{"processor\t: 0\nCPU architecture: 8\n", "v8"},
+		{"processor\t: 0\nCPU architecture: AArch64\n", "v8"},
+		{"processor\t: 0\nmodel name\t: Intel\n", ""},
+	}
+	for _, test := range tests {
+		if got, want := parseVariant(strings.NewReader(test.cpuinfo)), test.variant; got != want {
+			t.Errorf("Want variant %q, got %q", want, got)
+		}
+	}
+}
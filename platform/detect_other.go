@@ -0,0 +1,21 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package platform
+
+// kernel returns the kernel version of the host machine.
+// Kernel detection is not supported on this platform.
+func kernel() string {
+	return ""
+}
+
+// variant returns the architecture variant of the host
+// machine. Variant detection is not supported on this
+// platform.
+func variant() string {
+	return ""
+}
@@ -0,0 +1,48 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package platform
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/drone/runner-go/client"
+)
+
+func TestDetect(t *testing.T) {
+	filter := Detect()
+	if got, want := filter.OS, runtime.GOOS; got != want {
+		t.Errorf("Want os %q, got %q", want, got)
+	}
+	if got, want := filter.Arch, runtime.GOARCH; got != want {
+		t.Errorf("Want arch %q, got %q", want, got)
+	}
+}
+
+func TestPopulate(t *testing.T) {
+	filter := &client.Filter{OS: "windows", Kernel: "1809"}
+	Populate(filter)
+	if got, want := filter.OS, "windows"; got != want {
+		t.Errorf("Want os %q, got %q", want, got)
+	}
+	if got, want := filter.Kernel, "1809"; got != want {
+		t.Errorf("Want kernel %q, got %q", want, got)
+	}
+	if got, want := filter.Arch, runtime.GOARCH; got != want {
+		t.Errorf("Want arch %q, got %q", want, got)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if got, want := NormalizeArch("x86_64"), "amd64"; got != want {
+		t.Errorf("Want arch %q, got %q", want, got)
+	}
+	if got, want := NormalizeArch("aarch64"), "arm64"; got != want {
+		t.Errorf("Want arch %q, got %q", want, got)
+	}
+	if got, want := NormalizeOS("macOS"), "darwin"; got != want {
+		t.Errorf("Want os %q, got %q", want, got)
+	}
+}
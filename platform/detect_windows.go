@@ -0,0 +1,49 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+//go:build windows
+// +build windows
+
+package platform
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var procRtlGetVersion = syscall.NewLazyDLL("ntdll.dll").NewProc("RtlGetVersion")
+
+// osVersionInfo is the OSVERSIONINFOW structure.
+type osVersionInfo struct {
+	size        uint32
+	major       uint32
+	minor       uint32
+	build       uint32
+	platformID  uint32
+	servicePack [128]uint16
+}
+
+// kernel returns the kernel version of the host machine.
+// The version is read with RtlGetVersion, which returns the
+// actual version, because GetVersion returns the version
+// the binary is manifested for, which is 6.2 for a binary
+// without a manifest.
+func kernel() string {
+	if err := procRtlGetVersion.Find(); err != nil {
+		return ""
+	}
+	info := osVersionInfo{}
+	info.size = uint32(unsafe.Sizeof(info))
+	if status, _, _ := procRtlGetVersion.Call(uintptr(unsafe.Pointer(&info))); status != 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d.%d.%d", info.major, info.minor, info.build)
+}
+
+// variant returns the architecture variant of the host
+// machine.
+func variant() string {
+	return ""
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package platform provides helpers to route resources to
+// runners based on platform requirements and node labels.
+package platform
+
+import (
+	"github.com/drone/runner-go/client"
+	"github.com/drone/runner-go/manifest"
+)
+
+// Match returns true if the resource can be executed by a
+// runner with the filter. Empty resource requirements and
+// empty filter values match any value.
+func Match(resource manifest.Resource, filter *client.Filter) bool {
+	if filter == nil {
+		return true
+	}
+	if !matchString(resource.GetKind(), filter.Kind) ||
+		!matchString(resource.GetType(), filter.Type) {
+		return false
+	}
+	if v, ok := resource.(manifest.PlatformResource); ok {
+		if !MatchPlatform(v.GetPlatform(), filter) {
+			return false
+		}
+	}
+	if v, ok := resource.(manifest.RoutedResource); ok {
+		if !MatchNodes(v.GetNodes(), filter.Labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchPlatform returns true if the platform requirements
+// are satisfied by the filter. The platform version is
+// matched against the filter kernel version using
+// MatchVersion. On Linux the kernel version is the kernel
+// release (e.g. 5.4.0), not the distribution release, and on
+// Windows it is the operating system version (e.g.
+// 10.0.17763).
+func MatchPlatform(platform manifest.Platform, filter *client.Filter) bool {
+	return matchString(NormalizeOS(platform.OS), NormalizeOS(filter.OS)) &&
+		matchString(NormalizeArch(platform.Arch), NormalizeArch(filter.Arch)) &&
+		matchString(platform.Variant, filter.Variant) &&
+		(platform.Version == "" || filter.Kernel == "" ||
+			MatchVersion(platform.Version, filter.Kernel))
+}
+
+// MatchNodes returns true if the runner labels satisfy
+// the resource node requirements. Invalid node
+// requirements never match.
+func MatchNodes(nodes, labels map[string]string) bool {
+	if len(nodes) == 0 {
+		return true
+	}
+	selector, err := FromNodes(nodes)
+	if err != nil {
+		return false
+	}
+	return selector.Matches(labels)
+}
+
+// helper function returns true if the requirement is
+// empty, the value is empty, or both are equal.
+func matchString(want, got string) bool {
+	return want == "" || got == "" || want == got
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package platform
+
+import (
+	"testing"
+
+	"github.com/drone/runner-go/client"
+	"github.com/drone/runner-go/manifest"
+)
+
+type resource struct {
+	kind, typ string
+	platform  manifest.Platform
+	nodes     map[string]string
+}
+
+func (r *resource) GetVersion() string             { return "1" }
+func (r *resource) GetKind() string                { return r.kind }
+func (r *resource) GetType() string                { return r.typ }
+func (r *resource) GetName() string                { return "default" }
+func (r *resource) GetPlatform() manifest.Platform { return r.platform }
+func (r *resource) GetNodes() map[string]string    { return r.nodes }
+
+func TestMatch(t *testing.T) {
+	filter := &client.Filter{
+		Kind:    "pipeline",
+		Type:    "docker",
+		OS:      "linux",
+		Arch:    "arm64",
+		Variant: "v8",
+		Kernel:  "5.4.0-42-generic",
+		Labels: map[string]string{
+			"region": "us-east",
+			"gpu":    "true",
+		},
+	}
+	tests := []struct {
+		res   *resource
+		match bool
+	}{
+		{&resource{kind: "pipeline", typ: "docker"}, true},
+		{&resource{kind: "pipeline", typ: "exec"}, false},
+		{&resource{kind: "pipeline", platform: manifest.Platform{OS: "linux", Arch: "aarch64"}}, true},
+		{&resource{kind: "pipeline", platform: manifest.Platform{OS: "windows"}}, false},
+		{&resource{kind: "pipeline", platform: manifest.Platform{Arch: "amd64"}}, false},
+		{&resource{kind: "pipeline", platform: manifest.Platform{Variant: "v7"}}, false},
+		{&resource{kind: "pipeline", platform: manifest.Platform{Version: ">=5.4"}}, true},
+		{&resource{kind: "pipeline", platform: manifest.Platform{Version: "<5"}}, false},
+		{&resource{kind: "pipeline", nodes: map[string]string{"region": "us-east"}}, true},
+		{&resource{kind: "pipeline", nodes: map[string]string{"region": "in (us-west, eu)"}}, false},
+		{&resource{kind: "pipeline", nodes: map[string]string{"region": "notin (eu)"}}, true},
+		{&resource{kind: "pipeline", nodes: map[string]string{"region": "in us-west"}}, false},
+	}
+	for i, test := range tests {
+		if got, want := Match(test.res, filter), test.match; got != want {
+			t.Errorf("Want resource %d match is %v", i, want)
+		}
+	}
+}
+
+func TestMatch_EmptyFilter(t *testing.T) {
+	res := &resource{
+		kind:     "pipeline",
+		platform: manifest.Platform{OS: "linux", Version: ">=5.4"},
+	}
+	if !Match(res, nil) {
+		t.Errorf("Expect nil filter matches any resource")
+	}
+	if !Match(res, new(client.Filter)) {
+		t.Errorf("Expect empty filter matches any platform")
+	}
+	res.nodes = map[string]string{"region": "us-east"}
+	if Match(res, new(client.Filter)) {
+		t.Errorf("Expect empty filter labels do not match node requirements")
+	}
+}
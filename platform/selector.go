@@ -0,0 +1,243 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package platform
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Selector operators.
+const (
+	OpEquals       = "="
+	OpNotEquals    = "!="
+	OpIn           = "in"
+	OpNotIn        = "notin"
+	OpExists       = "exists"
+	OpDoesNotExist = "!"
+)
+
+type (
+	// Selector is a list of label requirements, all of
+	// which must be satisfied for the selector to match.
+	Selector []Requirement
+
+	// Requirement is a single label requirement.
+	Requirement struct {
+		Key      string
+		Operator string
+		Values   []string
+	}
+)
+
+// ParseSelector parses a comma separated list of label
+// requirements. The following requirement forms are
+// supported:
+//
+//	key=value
+//	key!=value
+//	key in (value1, value2)
+//	key notin (value1, value2)
+//	key
+//	!key
+func ParseSelector(s string) (Selector, error) {
+	var out Selector
+	for _, part := range splitSelector(s) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		req, err := parseRequirement(part)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, req)
+	}
+	return out, nil
+}
+
+// FromNodes returns a selector from the resource node
+// map. A node value may be a literal value, in which case
+// the label must equal the value, or a set expression
+// (e.g. in (value1, value2), notin (value1) or !=value).
+func FromNodes(nodes map[string]string) (Selector, error) {
+	var keys []string
+	for k := range nodes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var out Selector
+	for _, k := range keys {
+		v := strings.TrimSpace(nodes[k])
+		switch {
+		case hasSetPrefix(v, OpIn), hasSetPrefix(v, OpNotIn):
+			req, err := parseRequirement(k + " " + v)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, req)
+		case strings.HasPrefix(v, OpNotEquals):
+			out = append(out, Requirement{
+				Key:      k,
+				Operator: OpNotEquals,
+				Values:   []string{strings.TrimSpace(v[2:])},
+			})
+		default:
+			out = append(out, Requirement{
+				Key:      k,
+				Operator: OpEquals,
+				Values:   []string{v},
+			})
+		}
+	}
+	return out, nil
+}
+
+// Matches returns true if the labels satisfy all of the
+// selector requirements.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, req := range s {
+		if !req.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches returns true if the labels satisfy the
+// requirement.
+func (r Requirement) Matches(labels map[string]string) bool {
+	v, ok := labels[r.Key]
+	switch r.Operator {
+	case OpEquals, OpIn:
+		return ok && contains(r.Values, v)
+	case OpNotEquals, OpNotIn:
+		return !ok || !contains(r.Values, v)
+	case OpExists:
+		return ok
+	case OpDoesNotExist:
+		return !ok
+	default:
+		return false
+	}
+}
+
+// String returns the string representation of the
+// requirement.
+func (r Requirement) String() string {
+	switch r.Operator {
+	case OpIn, OpNotIn:
+		return fmt.Sprintf("%s %s (%s)", r.Key, r.Operator, strings.Join(r.Values, ", "))
+	case OpExists:
+		return r.Key
+	case OpDoesNotExist:
+		return "!" + r.Key
+	default:
+		return r.Key + r.Operator + strings.Join(r.Values, "")
+	}
+}
+
+// helper function parses a single label requirement.
+func parseRequirement(s string) (Requirement, error) {
+	if strings.HasPrefix(s, "!") && !strings.Contains(s, "=") {
+		key := strings.TrimSpace(s[1:])
+		if key == "" {
+			return Requirement{}, fmt.Errorf("selector: missing key: %q", s)
+		}
+		return Requirement{Key: key, Operator: OpDoesNotExist}, nil
+	}
+	if i := strings.Index(s, OpNotEquals); i != -1 {
+		return newRequirement(s, s[:i], OpNotEquals, s[i+2:])
+	}
+	if i := strings.Index(s, "=="); i != -1 {
+		return newRequirement(s, s[:i], OpEquals, s[i+2:])
+	}
+	if i := strings.Index(s, OpEquals); i != -1 {
+		return newRequirement(s, s[:i], OpEquals, s[i+1:])
+	}
+	fields := strings.SplitN(s, " ", 2)
+	key := strings.TrimSpace(fields[0])
+	if len(fields) == 1 {
+		return Requirement{Key: key, Operator: OpExists}, nil
+	}
+	rest := strings.TrimSpace(fields[1])
+	for _, op := range []string{OpNotIn, OpIn} {
+		if !hasSetPrefix(rest, op) {
+			continue
+		}
+		set := strings.TrimSpace(rest[len(op):])
+		if !strings.HasPrefix(set, "(") || !strings.HasSuffix(set, ")") {
+			return Requirement{}, fmt.Errorf("selector: invalid set: %q", s)
+		}
+		var values []string
+		for _, v := range strings.Split(set[1:len(set)-1], ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			return Requirement{}, fmt.Errorf("selector: empty set: %q", s)
+		}
+		return Requirement{Key: key, Operator: op, Values: values}, nil
+	}
+	return Requirement{}, fmt.Errorf("selector: invalid requirement: %q", s)
+}
+
+// helper function returns a new requirement with a single
+// value.
+func newRequirement(s, key, op, value string) (Requirement, error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return Requirement{}, fmt.Errorf("selector: missing key: %q", s)
+	}
+	return Requirement{
+		Key:      key,
+		Operator: op,
+		Values:   []string{strings.TrimSpace(value)},
+	}, nil
+}
+
+// helper function splits the selector on commas that are
+// not enclosed in parentheses.
+func splitSelector(s string) []string {
+	var out []string
+	var depth, start int
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				out = append(out, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(out, s[start:])
+}
+
+// helper function returns true if s begins with the set
+// operator followed by a space or opening parenthesis.
+func hasSetPrefix(s, op string) bool {
+	if !strings.HasPrefix(s, op) {
+		return false
+	}
+	rest := s[len(op):]
+	return strings.HasPrefix(rest, " ") || strings.HasPrefix(rest, "(")
+}
+
+// helper function returns true if the slice contains s.
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
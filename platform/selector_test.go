@@ -0,0 +1,119 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package platform
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseSelector(t *testing.T) {
+	got, err := ParseSelector("env in (prod, staging), zone=us-east, tier!=frontend, gpu, !spot, arch notin (arm)")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := Selector{
+		{Key: "env", Operator: OpIn, Values: []string{"prod", "staging"}},
+		{Key: "zone", Operator: OpEquals, Values: []string{"us-east"}},
+		{Key: "tier", Operator: OpNotEquals, Values: []string{"frontend"}},
+		{Key: "gpu", Operator: OpExists},
+		{Key: "spot", Operator: OpDoesNotExist},
+		{Key: "arch", Operator: OpNotIn, Values: []string{"arm"}},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected selector")
+		t.Log(diff)
+	}
+}
+
+func TestParseSelector_Error(t *testing.T) {
+	tests := []string{
+		"=value",
+		"!",
+		"env in prod",
+		"env in ()",
+		"env between (a, b)",
+	}
+	for _, test := range tests {
+		if _, err := ParseSelector(test); err == nil {
+			t.Errorf("Expect error parsing selector %q", test)
+		}
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	labels := map[string]string{
+		"env":  "prod",
+		"zone": "us-east",
+		"gpu":  "true",
+	}
+	tests := []struct {
+		selector string
+		match    bool
+	}{
+		{"", true},
+		{"env=prod", true},
+		{"env==prod", true},
+		{"env=staging", false},
+		{"env!=staging", true},
+		{"env in (prod, staging)", true},
+		{"env notin (prod)", false},
+		{"tier notin (frontend)", true},
+		{"gpu", true},
+		{"!gpu", false},
+		{"!spot", true},
+		{"env=prod, zone in (us-west)", false},
+	}
+	for _, test := range tests {
+		selector, err := ParseSelector(test.selector)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got, want := selector.Matches(labels), test.match; got != want {
+			t.Errorf("Want selector %q match is %v", test.selector, want)
+		}
+	}
+}
+
+func TestFromNodes(t *testing.T) {
+	got, err := FromNodes(map[string]string{
+		"zone": "us-east",
+		"env":  "in (prod, staging)",
+		"tier": "!= frontend",
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := Selector{
+		{Key: "env", Operator: OpIn, Values: []string{"prod", "staging"}},
+		{Key: "tier", Operator: OpNotEquals, Values: []string{"frontend"}},
+		{Key: "zone", Operator: OpEquals, Values: []string{"us-east"}},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected node selector")
+		t.Log(diff)
+	}
+}
+
+func TestRequirementString(t *testing.T) {
+	tests := []struct {
+		req  Requirement
+		want string
+	}{
+		{Requirement{Key: "env", Operator: OpEquals, Values: []string{"prod"}}, "env=prod"},
+		{Requirement{Key: "env", Operator: OpNotIn, Values: []string{"a", "b"}}, "env notin (a, b)"},
+		{Requirement{Key: "gpu", Operator: OpExists}, "gpu"},
+		{Requirement{Key: "gpu", Operator: OpDoesNotExist}, "!gpu"},
+	}
+	for _, test := range tests {
+		if got := test.req.String(); got != test.want {
+			t.Errorf("Want requirement string %q, got %q", test.want, got)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package platform
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MatchVersion returns true if the version satisfies the
+// version constraint. The constraint is a comma or space
+// separated list of conditions, each of which must be
+// satisfied. A condition is a version prefixed with an
+// optional operator (=, !=, >, >=, <, <=, ~ or ^). A
+// condition without an operator matches versions with the
+// same leading segments, where x or * matches any segment.
+//
+//	5.4         matches 5.4.0-42-generic
+//	>=5.4 <6    matches 5.10.1
+//	~1.2.3      matches >=1.2.3 <1.3
+//	^1.2        matches >=1.2 <2
+func MatchVersion(constraint, version string) bool {
+	v := parseVersion(version)
+	for _, cond := range splitConstraint(constraint) {
+		if !matchCondition(cond, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// helper function returns true if the version satisfies
+// the single condition.
+func matchCondition(cond string, v []int) bool {
+	op, s := splitOperator(cond)
+	c := parseVersion(s)
+	switch op {
+	case "=", "==":
+		return compareVersion(v, c) == 0
+	case "!=":
+		return compareVersion(v, c) != 0
+	case ">":
+		return compareVersion(v, c) > 0
+	case ">=":
+		return compareVersion(v, c) >= 0
+	case "<":
+		return compareVersion(v, c) < 0
+	case "<=":
+		return compareVersion(v, c) <= 0
+	case "~":
+		return compareVersion(v, c) >= 0 &&
+			compareVersion(v, bumpVersion(c, 1)) < 0
+	case "^":
+		return compareVersion(v, c) >= 0 &&
+			compareVersion(v, bumpVersion(c, 0)) < 0
+	default:
+		return prefixVersion(v, s)
+	}
+}
+
+// helper function returns true if the leading version
+// segments match the segments in s.
+func prefixVersion(v []int, s string) bool {
+	parts := strings.Split(trimVersion(s), ".")
+	for i, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || i >= len(v) || v[i] != n {
+			return false
+		}
+	}
+	return true
+}
+
+// helper function compares the two versions, returning a
+// negative number if a < b, zero if a == b, and a positive
+// number if a > b. Missing segments are treated as zero.
+func compareVersion(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
+
+// helper function returns the smallest version greater
+// than all versions sharing the segments up to index i.
+func bumpVersion(v []int, i int) []int {
+	if i >= len(v) {
+		i = len(v) - 1
+	}
+	if i < 0 {
+		return v
+	}
+	out := make([]int, i+1)
+	copy(out, v)
+	out[i]++
+	return out
+}
+
+// helper function parses the numeric segments of the
+// version string, ignoring any pre-release or build
+// suffix (e.g. 5.4.0-42-generic is parsed as 5.4.0).
+func parseVersion(s string) []int {
+	var out []int
+	for _, part := range strings.Split(trimVersion(s), ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			break
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+// helper function trims the version prefix and suffix.
+func trimVersion(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexAny(s, "-+ "); i != -1 {
+		s = s[:i]
+	}
+	return s
+}
+
+// helper function splits the constraint into conditions.
+func splitConstraint(s string) []string {
+	var out []string
+	var prev string
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' '
+	}) {
+		// join operators separated from the version by a
+		// space (e.g. >= 5.4).
+		if prev != "" {
+			part, prev = prev+part, ""
+		} else if op, v := splitOperator(part); op != "" && v == "" {
+			prev = op
+			continue
+		}
+		out = append(out, part)
+	}
+	return out
+}
+
+// helper function splits the operator from the version.
+func splitOperator(s string) (string, string) {
+	for _, op := range []string{"==", "!=", ">=", "<=", "=", ">", "<", "~", "^"} {
+		if strings.HasPrefix(s, op) {
+			return op, strings.TrimPrefix(s, op)
+		}
+	}
+	return "", s
+}
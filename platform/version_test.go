@@ -0,0 +1,42 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package platform
+
+import "testing"
+
+func TestMatchVersion(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		match      bool
+	}{
+		{"5.4", "5.4.0-42-generic", true},
+		{"5.4", "5.40.0", false},
+		{"5.x", "5.10.1", true},
+		{"5", "4.19.0", false},
+		{">=5.4", "5.10.1", true},
+		{">= 5.4", "5.10.1", true},
+		{">=5.4 <6", "6.1.0", false},
+		{">=5.4, <6", "5.15.0", true},
+		{">4.19", "4.19.0", false},
+		{"<=4.19", "4.19.0", true},
+		{"=10.0.17763", "10.0.17763", true},
+		{"!=10.0.17763", "10.0.17763", false},
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.3.0", false},
+		{"~1.2.3", "1.2.2", false},
+		{"^1.2", "1.9.0", true},
+		{"^1.2", "2.0.0", false},
+		{"v1.2.3", "1.2.3", true},
+		{"", "1.2.3", true},
+	}
+	for _, test := range tests {
+		got, want := MatchVersion(test.constraint, test.version), test.match
+		if got != want {
+			t.Errorf("Want constraint %q match version %q is %v",
+				test.constraint, test.version, want)
+		}
+	}
+}
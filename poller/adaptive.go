@@ -0,0 +1,237 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package poller
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/drone/runner-go/logger"
+)
+
+// default sampling interval.
+const defaultAdaptiveInterval = 10 * time.Second
+
+// Resources provides the host resource utilization, as a
+// fraction between 0 and 1.
+type Resources struct {
+	CPU    float64
+	Memory float64
+	Disk   float64
+}
+
+// Adaptive configures the poller to scale the number of
+// concurrent stage requests with the available host
+// resources. The capacity is reduced as resource
+// utilization approaches the configured thresholds, and
+// the poller stops requesting stages when any threshold
+// is exceeded. If Sample is nil on a platform where the
+// host resources cannot be sampled, the poller uses the
+// fixed capacity passed to Poll.
+type Adaptive struct {
+	// Min is the minimum capacity, which is used when the
+	// host is saturated. If zero, the poller stops
+	// requesting stages when the host is saturated.
+	Min int
+
+	// Max is the maximum capacity. If zero, the capacity
+	// passed to Poll is the maximum capacity.
+	Max int
+
+	// CPU, Memory and Disk are the maximum utilization
+	// thresholds, as a fraction between 0 and 1. A zero
+	// value disables the threshold.
+	CPU    float64
+	Memory float64
+	Disk   float64
+
+	// Path is the filesystem path used to measure disk
+	// utilization. If empty, the root path is used.
+	Path string
+
+	// Interval is the interval at which resource
+	// utilization is sampled.
+	Interval time.Duration
+
+	// Sample returns the host resource utilization. If nil,
+	// resource utilization is read from the host.
+	Sample func() (*Resources, error)
+}
+
+// Limit returns the capacity for the resource utilization.
+// The capacity is scaled between the minimum and maximum
+// capacity by the headroom of the most utilized resource,
+// relative to its threshold.
+func (a *Adaptive) Limit(r *Resources, max int) int {
+	min := a.Min
+	if min > max {
+		min = max
+	}
+	headroom := 1.0
+	for _, v := range []struct{ usage, threshold float64 }{
+		{r.CPU, a.CPU},
+		{r.Memory, a.Memory},
+		{r.Disk, a.Disk},
+	} {
+		if v.threshold <= 0 {
+			continue
+		}
+		if h := (v.threshold - v.usage) / v.threshold; h < headroom {
+			headroom = h
+		}
+	}
+	if headroom <= 0 {
+		return min
+	}
+	return min + int(math.Ceil(headroom*float64(max-min)))
+}
+
+// adapt periodically samples the host resources and updates
+// the poller capacity until the context is canceled.
+func (p *Poller) adapt(ctx context.Context, sample func() (*Resources, error), max int) {
+	interval := p.Adaptive.Interval
+	if interval <= 0 {
+		interval = defaultAdaptiveInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.resize(ctx, sample, max)
+		}
+	}
+}
+
+// resize samples the host resources and updates the poller
+// capacity. If the host resources cannot be sampled, the
+// capacity is unchanged.
+func (p *Poller) resize(ctx context.Context, sample func() (*Resources, error), max int) {
+	log := logger.FromContext(ctx)
+	r, err := sample()
+	if err != nil {
+		log.WithError(err).
+			Warnln("poller: cannot sample host resources")
+		return
+	}
+	limit := p.Adaptive.Limit(r, max)
+	if prev := p.gate.set(limit); prev != limit {
+		log.WithField("cpu", r.CPU).
+			WithField("memory", r.Memory).
+			WithField("disk", r.Disk).
+			WithField("capacity", limit).
+			Debugln("poller: capacity adjusted")
+	}
+	atomic.StoreInt64(&p.capacity, int64(limit))
+}
+
+// gate limits the number of stages that are concurrently
+// requested or executed. The limit can be adjusted while
+// stages are executing.
+type gate struct {
+	mu      sync.Mutex
+	limit   int
+	slots   []*slot
+	changed chan struct{}
+}
+
+// slot is a gate slot held by a pending request or by an
+// executing stage.
+type slot struct {
+	// lowered is closed when the limit is lowered and the
+	// pending request must be canceled.
+	lowered chan struct{}
+
+	// pending is true until the stage is dispatched, or
+	// the pending request is canceled.
+	pending bool
+}
+
+func newGate(limit int) *gate {
+	return &gate{
+		limit:   limit,
+		changed: make(chan struct{}),
+	}
+}
+
+// acquire blocks until a slot is available or the context
+// is canceled. The slot channel is closed if the limit is
+// lowered, which is used to cancel the pending request.
+func (g *gate) acquire(ctx context.Context) (*slot, error) {
+	for {
+		g.mu.Lock()
+		if len(g.slots) < g.limit {
+			s := &slot{lowered: make(chan struct{}), pending: true}
+			g.slots = append(g.slots, s)
+			g.mu.Unlock()
+			return s, nil
+		}
+		changed := g.changed
+		g.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// dispatch marks the slot as held by an executing stage,
+// which is not canceled when the limit is lowered.
+func (g *gate) dispatch(s *slot) {
+	g.mu.Lock()
+	s.pending = false
+	g.mu.Unlock()
+}
+
+// release releases the slot.
+func (g *gate) release(s *slot) {
+	g.mu.Lock()
+	for i, v := range g.slots {
+		if v == s {
+			g.slots = append(g.slots[:i], g.slots[i+1:]...)
+			break
+		}
+	}
+	g.notify()
+	g.mu.Unlock()
+}
+
+// set sets the limit and returns the previous limit. If the
+// limit is lowered, the most recently acquired pending
+// requests that exceed the limit are canceled, and the
+// remaining requests stay connected.
+func (g *gate) set(limit int) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	prev := g.limit
+	if limit == prev {
+		return prev
+	}
+	g.limit = limit
+	excess := len(g.slots) - limit
+	for i := len(g.slots) - 1; i >= 0 && excess > 0; i-- {
+		if s := g.slots[i]; s.pending {
+			s.pending = false
+			close(s.lowered)
+			excess--
+		}
+	}
+	g.notify()
+	return prev
+}
+
+// notify notifies goroutines waiting for a slot that the
+// gate changed. The caller must hold the lock.
+func (g *gate) notify() {
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
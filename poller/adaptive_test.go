@@ -0,0 +1,163 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package poller
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+)
+
+func TestAdaptive_Limit(t *testing.T) {
+	a := &Adaptive{CPU: 0.8, Memory: 0.9}
+	tests := []struct {
+		resources Resources
+		min       int
+		want      int
+	}{
+		{Resources{}, 0, 4},
+		{Resources{CPU: 0.4}, 0, 2},
+		{Resources{CPU: 0.2, Memory: 0.6}, 0, 2},
+		{Resources{CPU: 0.79}, 0, 1},
+		{Resources{CPU: 0.8}, 0, 0},
+		{Resources{Memory: 0.95}, 0, 0},
+		{Resources{Memory: 0.95}, 1, 1},
+		{Resources{Disk: 0.99}, 0, 4}, // threshold disabled
+	}
+	for _, test := range tests {
+		a.Min = test.min
+		if got := a.Limit(&test.resources, 4); got != test.want {
+			t.Errorf("Want capacity %d for %+v, got %d", test.want, test.resources, got)
+		}
+	}
+}
+
+func TestGate(t *testing.T) {
+	g := newGate(1)
+	held, err := g.acquire(noContext)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// the gate is full and must block until the context
+	// is canceled.
+	ctx, cancel := context.WithTimeout(noContext, 10*time.Millisecond)
+	defer cancel()
+	if _, err := g.acquire(ctx); err == nil {
+		t.Errorf("Expect acquire blocks when the gate is full")
+	}
+
+	g.set(0)
+	select {
+	case <-held.lowered:
+	default:
+		t.Errorf("Expect channel closed when the limit is lowered")
+	}
+
+	// raising the limit unblocks waiting goroutines.
+	acquired := make(chan struct{})
+	go func() {
+		g.acquire(noContext)
+		close(acquired)
+	}()
+	g.release(held)
+	g.set(1)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Errorf("Expect acquire unblocks when the limit is raised")
+	}
+}
+
+// this test verifies that lowering the limit cancels only
+// the most recently acquired pending requests that exceed
+// the limit, and not the executing stages.
+func TestGate_Lowered(t *testing.T) {
+	g := newGate(4)
+	var slots []*slot
+	for i := 0; i < 4; i++ {
+		s, _ := g.acquire(noContext)
+		slots = append(slots, s)
+	}
+	g.dispatch(slots[3])
+
+	g.set(2)
+	for i, want := range []bool{false, true, true, false} {
+		var got bool
+		select {
+		case <-slots[i].lowered:
+			got = true
+		default:
+		}
+		if got != want {
+			t.Errorf("Want slot %d canceled %v, got %v", i, want, got)
+		}
+	}
+}
+
+func TestPoll_Adaptive(t *testing.T) {
+	var mu sync.Mutex
+	resources := &Resources{CPU: 0.9}
+
+	ctx, cancel := context.WithCancel(noContext)
+	defer cancel()
+
+	mock := &mockCountClient{requested: make(chan struct{}, 10)}
+	p := &Poller{
+		Client: mock,
+		Adaptive: &Adaptive{
+			CPU:      0.8,
+			Interval: time.Millisecond,
+			Sample: func() (*Resources, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				copy := *resources
+				return &copy, nil
+			},
+		},
+	}
+	go p.Poll(ctx, 2)
+
+	select {
+	case <-mock.requested:
+		t.Errorf("Expect no requests when the host is saturated")
+		return
+	case <-time.After(20 * time.Millisecond):
+	}
+	if got := p.Capacity(); got != 0 {
+		t.Errorf("Want capacity 0 when the host is saturated, got %d", got)
+	}
+
+	mu.Lock()
+	resources.CPU = 0.1
+	mu.Unlock()
+
+	select {
+	case <-mock.requested:
+	case <-time.After(time.Second):
+		t.Errorf("Expect requests when the host has capacity")
+	}
+}
+
+// mock client that signals when a stage is requested, and
+// then blocks until the context is canceled.
+type mockCountClient struct {
+	client.Client
+	requested chan struct{}
+}
+
+func (m *mockCountClient) Request(ctx context.Context, args *client.Filter) (*drone.Stage, error) {
+	select {
+	case m.requested <- struct{}{}:
+	default:
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
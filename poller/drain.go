@@ -0,0 +1,90 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package poller
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/drone/runner-go/logger"
+)
+
+// Poller states reported by the health check.
+const (
+	StatusPolling  = "polling"
+	StatusDraining = "draining"
+)
+
+// Drain stops the poller from requesting new stages. Pending
+// requests are canceled, and Poll returns once the dispatched
+// stages complete or the drain timeout expires. It is safe to
+// call Drain more than once.
+func (p *Poller) Drain() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.draining == nil {
+		p.draining = make(chan struct{})
+	}
+	select {
+	case <-p.draining:
+	default:
+		close(p.draining)
+	}
+}
+
+// Draining returns true if the poller is draining.
+func (p *Poller) Draining() bool {
+	select {
+	case <-p.drained():
+		return true
+	default:
+		return false
+	}
+}
+
+// Check returns the poller status. It can be used as a
+// health check. A draining or paused poller is considered
+// healthy so that the runner is not restarted before the
+// dispatched stages complete.
+func (p *Poller) Check() (string, error) {
+	if p.Draining() {
+		return StatusDraining, nil
+	}
+	if p.Paused() {
+		return StatusPaused, nil
+	}
+	return StatusPolling, nil
+}
+
+// DrainOnSignal drains the poller when one of the signals is
+// received. It blocks until a signal is received, the poller
+// is drained, or the context is canceled.
+func (p *Poller) DrainOnSignal(ctx context.Context, sig ...os.Signal) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sig...)
+	defer signal.Stop(c)
+
+	select {
+	case s := <-c:
+		logger.FromContext(ctx).
+			WithField("signal", s.String()).
+			Infoln("poller: received signal, draining")
+		p.Drain()
+	case <-p.drained():
+	case <-ctx.Done():
+	}
+}
+
+// drained returns a channel that is closed when the poller
+// is draining.
+func (p *Poller) drained() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.draining == nil {
+		p.draining = make(chan struct{})
+	}
+	return p.draining
+}
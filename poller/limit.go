@@ -0,0 +1,173 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package poller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/drone/runner-go/logger"
+)
+
+// Poller exit errors, reported by Err when the poller exits
+// because the configured limits are reached.
+var (
+	ErrMaxStages   = errors.New("poller: maximum stages executed")
+	ErrIdleTimeout = errors.New("poller: idle timeout exceeded")
+)
+
+// Err returns the reason the poller exited. It returns nil
+// if the poller has not exited, or exited because the
+// context was canceled or the poller was drained.
+func (p *Poller) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// stop stops the poller from requesting new stages and
+// records the reason the poller exits. Only the first
+// reason is recorded.
+func (p *Poller) stop(err error) {
+	stopping := p.stopped()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-stopping:
+	default:
+		p.err = err
+		close(p.stopping)
+	}
+}
+
+// stopped returns a channel that is closed when the poller
+// is stopped.
+func (p *Poller) stopped() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopping == nil {
+		p.stopping = make(chan struct{})
+	}
+	return p.stopping
+}
+
+// isStopping returns true if the poller is draining or is
+// stopped.
+func (p *Poller) isStopping() bool {
+	select {
+	case <-p.stopped():
+		return true
+	default:
+		return p.Draining()
+	}
+}
+
+// idle stops the poller when no stage is executed for the
+// idle timeout. It blocks until the context is canceled.
+func (p *Poller) idle(ctx context.Context) {
+	timeout := p.IdleTimeout
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		p.mu.Lock()
+		elapsed := time.Since(p.active)
+		p.mu.Unlock()
+		if p.Running() == 0 && elapsed >= timeout {
+			logger.FromContext(ctx).
+				WithField("timeout", timeout).
+				Infoln("poller: idle timeout exceeded, exiting")
+			p.stop(ErrIdleTimeout)
+			return
+		}
+		if wait := timeout - elapsed; wait > 0 {
+			timer.Reset(wait)
+		} else {
+			timer.Reset(timeout)
+		}
+	}
+}
+
+// touch records that the poller is active.
+func (p *Poller) touch() {
+	p.mu.Lock()
+	p.active = time.Now()
+	p.mu.Unlock()
+}
+
+// budget limits the number of stages dispatched by the
+// poller. A thread reserves a stage before requesting
+// the stage, which ensures the number of pending requests
+// never exceeds the number of remaining stages.
+type budget struct {
+	mu       sync.Mutex
+	max      int
+	reserved int
+	used     int
+	changed  chan struct{}
+}
+
+func newBudget(max int) *budget {
+	return &budget{max: max, changed: make(chan struct{})}
+}
+
+// reserve blocks until a stage can be reserved, and returns
+// false if the budget is exhausted or the context is
+// canceled.
+func (b *budget) reserve(ctx context.Context) bool {
+	for {
+		b.mu.Lock()
+		if b.used >= b.max {
+			b.mu.Unlock()
+			return false
+		}
+		if b.used+b.reserved < b.max {
+			b.reserved++
+			b.mu.Unlock()
+			return true
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// commit commits the reserved stage, and returns true if
+// the budget is exhausted.
+func (b *budget) commit() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reserved--
+	b.used++
+	b.notify()
+	return b.used >= b.max
+}
+
+// release releases the reserved stage, for example, if the
+// request did not return a stage.
+func (b *budget) release() {
+	b.mu.Lock()
+	b.reserved--
+	b.notify()
+	b.mu.Unlock()
+}
+
+// notify notifies goroutines waiting for a reservation that
+// the budget changed. The caller must hold the lock.
+func (b *budget) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
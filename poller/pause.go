@@ -0,0 +1,83 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package poller
+
+import (
+	"context"
+)
+
+// StatusPaused is the poller state reported by the health
+// check when the poller is paused.
+const StatusPaused = "paused"
+
+// Pause stops the poller from requesting new stages until
+// the poller is resumed. Pending requests are canceled, and
+// dispatched stages continue to execute.
+func (p *Poller) Pause() {
+	p.setPaused(true)
+}
+
+// Resume resumes requesting new stages.
+func (p *Poller) Resume() {
+	p.setPaused(false)
+}
+
+// Paused returns true if the poller is paused.
+func (p *Poller) Paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
+
+// setPaused sets the paused state and notifies the polling
+// threads if the state changed.
+func (p *Poller) setPaused(paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paused == paused {
+		return
+	}
+	p.paused = paused
+	if p.pauseChanged != nil {
+		close(p.pauseChanged)
+	}
+	p.pauseChanged = make(chan struct{})
+}
+
+// pauseState returns the paused state, and a channel that
+// is closed when the state changes.
+func (p *Poller) pauseState() (bool, <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pauseChanged == nil {
+		p.pauseChanged = make(chan struct{})
+	}
+	return p.paused, p.pauseChanged
+}
+
+// waitResume blocks while the poller is paused. It returns
+// a context that is canceled if the poller is paused, which
+// is used to cancel pending requests.
+func (p *Poller) waitResume(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	for {
+		paused, changed := p.pauseState()
+		if !paused {
+			ctx, cancel := context.WithCancel(ctx)
+			go func() {
+				select {
+				case <-changed:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+			return ctx, cancel, nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package poller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+)
+
+func TestPoll_Pause(t *testing.T) {
+	mock := &mockCountClient{requested: make(chan struct{})}
+	p := &Poller{Client: mock}
+
+	ctx, cancel := context.WithCancel(noContext)
+	defer cancel()
+	go p.Poll(ctx, 1)
+
+	select {
+	case <-mock.requested:
+	case <-time.After(time.Second):
+		t.Errorf("Expect poller requests a stage")
+		return
+	}
+
+	p.Pause()
+	if !p.Paused() {
+		t.Errorf("Expect poller paused")
+	}
+	if status, _ := p.Check(); status != StatusPaused {
+		t.Errorf("Want status %q, got %q", StatusPaused, status)
+	}
+	select {
+	case <-mock.requested:
+		t.Errorf("Expect paused poller does not request stages")
+		return
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	p.Resume()
+	if status, _ := p.Check(); status != StatusPolling {
+		t.Errorf("Want status %q, got %q", StatusPolling, status)
+	}
+	select {
+	case <-mock.requested:
+	case <-time.After(time.Second):
+		t.Errorf("Expect resumed poller requests a stage")
+	}
+}
+
+func TestPoll_PauseNotDispatched(t *testing.T) {
+	p := &Poller{
+		Client: &mockQueueClient{stages: []*drone.Stage{{ID: 1}}},
+		Dispatch: func(context.Context, *drone.Stage) error {
+			t.Errorf("Expect stage not dispatched while paused")
+			return nil
+		},
+	}
+	p.Pause()
+
+	ctx, cancel := context.WithTimeout(noContext, 10*time.Millisecond)
+	defer cancel()
+	if err := p.poll(ctx, 1); err != nil {
+		t.Error(err)
+	}
+}
@@ -7,6 +7,8 @@ package poller
 import (
 	"context"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/drone/drone-go/drone"
 	"github.com/drone/runner-go/client"
@@ -15,22 +17,139 @@ import (
 
 var noContext = context.Background()
 
+// waiter is implemented by clients that can block until
+// requests to the server are permitted (e.g. a circuit
+// breaker).
+type waiter interface {
+	Wait(context.Context) error
+}
+
 // Poller polls the server for pending stages and dispatches
 // for execution by the Runner.
 type Poller struct {
 	Client client.Client
 	Filter *client.Filter
 
+	// Queues optionally provides multiple filters used to
+	// request stages, with a priority and weight. If set,
+	// the Filter is ignored.
+	Queues []*Queue
+
+	// QueueTimeout is the duration a request waits for a
+	// stage from a single queue before the next queue is
+	// requested, when multiple queues are configured.
+	QueueTimeout time.Duration
+
 	// Dispatch is dispatches the resource for processing.
 	// It is invoked by the poller when a resource is
 	// received by the remote system.
 	Dispatch func(context.Context, *drone.Stage) error
+
+	// DrainTimeout is the maximum duration to wait for the
+	// dispatched stages to complete when the poller is
+	// drained. If zero, the poller waits indefinitely.
+	DrainTimeout time.Duration
+
+	// MaxStages is the maximum number of stages dispatched
+	// before the poller exits, for example, to execute a
+	// single stage on an ephemeral runner. If zero, the
+	// number of stages is unlimited.
+	MaxStages int
+
+	// IdleTimeout is the duration after which the poller
+	// exits if no stage is executed. If zero, the poller
+	// never exits when idle.
+	IdleTimeout time.Duration
+
+	// Adaptive optionally scales the number of concurrent
+	// stage requests with the available host resources.
+	Adaptive *Adaptive
+
+	gate     *gate
+	budget   *budget
+	sched    *scheduler
+	capacity int64
+	running  int64
+
+	mu       sync.Mutex
+	draining chan struct{}
+	stopping chan struct{}
+	active   time.Time
+	err      error
+
+	paused       bool
+	pauseChanged chan struct{}
+}
+
+// Capacity returns the number of stages the poller can
+// execute concurrently. If the poller is adaptive, the
+// capacity changes with the available host resources.
+func (p *Poller) Capacity() int {
+	return int(atomic.LoadInt64(&p.capacity))
+}
+
+// Running returns the number of stages being executed.
+func (p *Poller) Running() int {
+	return int(atomic.LoadInt64(&p.running))
 }
 
 // Poll opens N connections to the server to poll for pending
 // stages for execution. Pending stages are dispatched to a
-// Runner for execution.
+// Runner for execution. If the poller is adaptive, N is the
+// maximum number of connections, unless the maximum capacity
+// is configured.
+//
+// Poll returns when the context is canceled, or when the
+// poller is drained or the configured limits are reached
+// and the dispatched stages complete. Err reports the
+// reason the poller exited.
 func (p *Poller) Poll(ctx context.Context, n int) {
+	atomic.StoreInt64(&p.capacity, int64(n))
+
+	// cancel pending requests when the poller is drained
+	// or stopped.
+	draining := p.drained()
+	stopping := p.stopped()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-draining:
+			cancel()
+		case <-stopping:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if p.MaxStages > 0 {
+		p.budget = newBudget(p.MaxStages)
+	}
+	if p.IdleTimeout > 0 {
+		p.touch()
+		go p.idle(ctx)
+	}
+
+	adaptive := p.Adaptive != nil
+	if adaptive && p.Adaptive.Sample == nil && !samplingSupported {
+		logger.FromContext(ctx).
+			WithField("capacity", n).
+			Warnln("poller: resource sampling not supported, using fixed capacity")
+		adaptive = false
+	}
+	if adaptive {
+		if p.Adaptive.Max > 0 {
+			n = p.Adaptive.Max
+		}
+		sample := p.Adaptive.Sample
+		if sample == nil {
+			sample = newSampler(p.Adaptive.Path).Sample
+		}
+		p.gate = newGate(n)
+		p.resize(ctx, sample, n)
+		go p.adapt(ctx, sample, n)
+	}
+
 	var wg sync.WaitGroup
 	for i := 0; i < n; i++ {
 		wg.Add(1)
@@ -47,22 +166,114 @@ func (p *Poller) Poll(ctx context.Context, n int) {
 		}(i)
 	}
 
-	wg.Wait()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-draining:
+	}
+
+	logger.FromContext(ctx).
+		WithField("running", p.Running()).
+		Infoln("poller: draining, waiting for stages to complete")
+
+	if p.DrainTimeout <= 0 {
+		<-done
+		return
+	}
+	timer := time.NewTimer(p.DrainTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		logger.FromContext(ctx).
+			WithField("running", p.Running()).
+			Warnln("poller: drain timeout exceeded")
+	}
 }
 
 // poll requests a stage for execution from the server, and then
 // dispatches for execution.
 func (p *Poller) poll(ctx context.Context, thread int) error {
 	log := logger.FromContext(ctx).WithField("thread", thread)
+
+	// if the poller is paused we wait until the poller is
+	// resumed. If the poller is paused while the request is
+	// pending, the request is canceled.
+	ctx, cancel, err := p.waitResume(ctx)
+	if err != nil {
+		log.WithError(err).Trace("poller: no stage returned")
+		return nil
+	}
+	defer cancel()
+
+	// if the poller is adaptive we wait until the host has
+	// capacity to execute the stage. If the capacity is
+	// reduced, the pending request is canceled.
+	var held *slot
+	if p.gate != nil {
+		held, err = p.gate.acquire(ctx)
+		if err != nil {
+			log.WithError(err).Trace("poller: no stage returned")
+			return nil
+		}
+		defer p.gate.release(held)
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			select {
+			case <-held.lowered:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	// if the number of stages is limited we reserve the
+	// stage before it is requested, which ensures pending
+	// requests never exceed the remaining stages.
+	committed := false
+	if p.budget != nil {
+		if !p.budget.reserve(ctx) {
+			return nil
+		}
+		defer func() {
+			if !committed {
+				p.budget.release()
+			}
+		}()
+	}
+
+	// if the client is unable to reach the server (e.g. the
+	// circuit breaker is open) we pause until requests are
+	// permitted instead of repeatedly requesting a stage.
+	if w, ok := p.Client.(waiter); ok {
+		if err := w.Wait(ctx); err != nil {
+			log.WithError(err).Trace("poller: no stage returned")
+			return nil
+		}
+	}
+
 	log.WithField("thread", thread).Debug("poller: request stage from remote server")
 
 	// request a new build stage for execution from the central
 	// build server.
-	stage, err := p.Client.Request(ctx, p.Filter)
+	stage, err := p.request(ctx)
 	if err == context.Canceled || err == context.DeadlineExceeded {
 		log.WithError(err).Trace("poller: no stage returned")
 		return nil
 	}
+	if err == client.ErrCircuitOpen {
+		log.WithError(err).Debug("poller: server unavailable")
+		return err
+	}
 	if err != nil {
 		log.WithError(err).Error("poller: cannot request stage")
 		return err
@@ -74,6 +285,39 @@ func (p *Poller) poll(ctx context.Context, thread int) error {
 		return nil
 	}
 
+	// if the poller started draining or stopped while the
+	// request was in progress, the stage is not dispatched.
+	// The stage is not yet accepted and is executed by
+	// another runner.
+	if p.isStopping() {
+		log.WithField("stage.id", stage.ID).
+			Debug("poller: stopping, stage not dispatched")
+		return nil
+	}
+	if p.Paused() {
+		log.WithField("stage.id", stage.ID).
+			Debug("poller: paused, stage not dispatched")
+		return nil
+	}
+
+	// if this is the last stage, the poller stops requesting
+	// stages and exits when the stage completes.
+	if p.budget != nil {
+		committed = true
+		if p.budget.commit() {
+			log.Debug("poller: maximum stages reached")
+			p.stop(ErrMaxStages)
+		}
+	}
+
+	if held != nil {
+		p.gate.dispatch(held)
+	}
+
+	p.touch()
+	defer p.touch()
+	atomic.AddInt64(&p.running, 1)
+	defer atomic.AddInt64(&p.running, -1)
 	return p.Dispatch(
 		logger.WithContext(noContext, log), stage)
 }
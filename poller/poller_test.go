@@ -4,7 +4,15 @@
 
 package poller
 
-import "testing"
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+)
 
 func TestPoll(t *testing.T) {
 	t.Skip()
@@ -21,3 +29,294 @@ func TestPoll_EmptyStage(t *testing.T) {
 func TestPoll_RequestError(t *testing.T) {
 	t.Skip()
 }
+
+func TestPoll_Wait(t *testing.T) {
+	ctx, cancel := context.WithCancel(noContext)
+	cancel()
+
+	mock := &mockWaitClient{}
+	p := &Poller{Client: mock}
+	if err := p.poll(ctx, 1); err != nil {
+		t.Error(err)
+	}
+	if !mock.waited {
+		t.Errorf("Expect poller waits for the client")
+	}
+	if mock.requested {
+		t.Errorf("Expect poller does not request a stage while waiting")
+	}
+}
+
+func TestPoll_Running(t *testing.T) {
+	var running int
+	p := &Poller{Client: &mockStageClient{stage: &drone.Stage{ID: 1}}}
+	p.Dispatch = func(context.Context, *drone.Stage) error {
+		running = p.Running()
+		return nil
+	}
+	if err := p.poll(noContext, 1); err != nil {
+		t.Error(err)
+	}
+	if running != 1 {
+		t.Errorf("Want 1 running stage during dispatch, got %d", running)
+	}
+	if got := p.Running(); got != 0 {
+		t.Errorf("Want 0 running stages after dispatch, got %d", got)
+	}
+}
+
+// mock client that returns the stage.
+type mockStageClient struct {
+	client.Client
+	stage *drone.Stage
+}
+
+func (m *mockStageClient) Request(ctx context.Context, args *client.Filter) (*drone.Stage, error) {
+	return m.stage, nil
+}
+
+// mock client that blocks until the context is canceled
+// when the poller waits for requests to be permitted.
+type mockWaitClient struct {
+	client.Client
+
+	waited    bool
+	requested bool
+}
+
+func (m *mockWaitClient) Wait(ctx context.Context) error {
+	m.waited = true
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (m *mockWaitClient) Request(ctx context.Context, args *client.Filter) (*drone.Stage, error) {
+	m.requested = true
+	return nil, nil
+}
+
+func TestPoll_Drain(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	p := &Poller{
+		Client: &mockQueueClient{stages: []*drone.Stage{{ID: 1}}},
+		Dispatch: func(context.Context, *drone.Stage) error {
+			close(started)
+			<-release
+			return nil
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.Poll(noContext, 2)
+		close(done)
+	}()
+
+	<-started
+	p.Drain()
+	if status, _ := p.Check(); status != StatusDraining {
+		t.Errorf("Want status %q, got %q", StatusDraining, status)
+	}
+
+	select {
+	case <-done:
+		t.Errorf("Expect poller waits for dispatched stages")
+		return
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("Expect poller exits when dispatched stages complete")
+	}
+}
+
+func TestPoll_DrainTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	p := &Poller{
+		Client:       &mockQueueClient{stages: []*drone.Stage{{ID: 1}}},
+		DrainTimeout: 10 * time.Millisecond,
+		Dispatch: func(context.Context, *drone.Stage) error {
+			close(started)
+			<-release
+			return nil
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.Poll(noContext, 1)
+		close(done)
+	}()
+
+	<-started
+	p.Drain()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("Expect poller exits when the drain timeout expires")
+	}
+}
+
+func TestPoll_DrainNotDispatched(t *testing.T) {
+	p := &Poller{
+		Client: &mockStageClient{stage: &drone.Stage{ID: 1}},
+		Dispatch: func(context.Context, *drone.Stage) error {
+			t.Errorf("Expect stage not dispatched when draining")
+			return nil
+		},
+	}
+	p.Drain()
+	p.Drain() // drain is idempotent
+	if err := p.poll(noContext, 1); err != nil {
+		t.Error(err)
+	}
+}
+
+// mock client that returns the queued stages, and then
+// blocks until the context is canceled.
+type mockQueueClient struct {
+	client.Client
+
+	sync.Mutex
+	stages []*drone.Stage
+}
+
+func (m *mockQueueClient) Request(ctx context.Context, args *client.Filter) (*drone.Stage, error) {
+	m.Lock()
+	if len(m.stages) != 0 {
+		stage := m.stages[0]
+		m.stages = m.stages[1:]
+		m.Unlock()
+		return stage, nil
+	}
+	m.Unlock()
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestPoll_MaxStages(t *testing.T) {
+	var mu sync.Mutex
+	var dispatched int
+	mock := &mockQueueClient{stages: []*drone.Stage{{ID: 1}, {ID: 2}, {ID: 3}}}
+	p := &Poller{
+		Client:    mock,
+		MaxStages: 2,
+		Dispatch: func(context.Context, *drone.Stage) error {
+			mu.Lock()
+			dispatched++
+			mu.Unlock()
+			return nil
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.Poll(noContext, 3)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("Expect poller exits when maximum stages are executed")
+		return
+	}
+	if got, want := dispatched, 2; got != want {
+		t.Errorf("Want %d stages dispatched, got %d", want, got)
+	}
+	if got, want := p.Err(), ErrMaxStages; got != want {
+		t.Errorf("Want error %v, got %v", want, got)
+	}
+	if got, want := len(mock.stages), 1; got != want {
+		t.Errorf("Want %d stages not requested, got %d", want, got)
+	}
+}
+
+func TestPoll_OneShot(t *testing.T) {
+	mock := &mockConcurrentClient{}
+	p := &Poller{
+		Client:    mock,
+		MaxStages: 1,
+		Dispatch: func(context.Context, *drone.Stage) error {
+			return nil
+		},
+	}
+	p.Poll(noContext, 3)
+	if got, want := mock.max, 1; got != want {
+		t.Errorf("Want %d concurrent requests for a single stage, got %d", want, got)
+	}
+	if got, want := p.Err(), ErrMaxStages; got != want {
+		t.Errorf("Want error %v, got %v", want, got)
+	}
+}
+
+func TestPoll_IdleTimeout(t *testing.T) {
+	p := &Poller{
+		Client:      &mockQueueClient{},
+		IdleTimeout: 10 * time.Millisecond,
+	}
+	done := make(chan struct{})
+	go func() {
+		p.Poll(noContext, 2)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("Expect poller exits when idle")
+		return
+	}
+	if got, want := p.Err(), ErrIdleTimeout; got != want {
+		t.Errorf("Want error %v, got %v", want, got)
+	}
+}
+
+func TestPoll_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(noContext)
+	cancel()
+	p := &Poller{Client: &mockQueueClient{}}
+	p.Poll(ctx, 1)
+	if err := p.Err(); err != nil {
+		t.Errorf("Want no error when the context is canceled, got %v", err)
+	}
+}
+
+// mock client that records the maximum number of concurrent
+// requests. The first request returns a stage after a delay,
+// subsequent requests return no stage.
+type mockConcurrentClient struct {
+	client.Client
+
+	sync.Mutex
+	active int
+	max    int
+	served bool
+}
+
+func (m *mockConcurrentClient) Request(ctx context.Context, args *client.Filter) (*drone.Stage, error) {
+	m.Lock()
+	m.active++
+	if m.active > m.max {
+		m.max = m.active
+	}
+	m.Unlock()
+
+	select {
+	case <-time.After(5 * time.Millisecond):
+	case <-ctx.Done():
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	m.active--
+	if m.served || ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	m.served = true
+	return &drone.Stage{ID: 1}, nil
+}
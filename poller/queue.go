@@ -0,0 +1,143 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package poller
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+)
+
+// default duration a request waits for a stage from a
+// single queue before the next queue is requested.
+const defaultQueueTimeout = 10 * time.Second
+
+// Queue is a filter used to request stages from the server,
+// with a priority and weight.
+type Queue struct {
+	Filter *client.Filter
+
+	// Priority defines the order in which queues are
+	// requested. Queues with a higher priority are
+	// requested first.
+	Priority int
+
+	// Weight defines how often the queue is requested
+	// first, regardless of priority, relative to the
+	// weight of other queues. This ensures lower priority
+	// queues are not starved. If the weight of all queues
+	// is zero, queues are requested in priority order.
+	Weight int
+}
+
+// scheduler orders the queues for each request using
+// smooth weighted round robin to select the first queue,
+// followed by the remaining queues in priority order.
+type scheduler struct {
+	mu      sync.Mutex
+	queues  []*Queue
+	current []int
+}
+
+func newScheduler(queues []*Queue) *scheduler {
+	sorted := make([]*Queue, len(queues))
+	copy(sorted, queues)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority > sorted[j].Priority
+	})
+	return &scheduler{
+		queues:  sorted,
+		current: make([]int, len(sorted)),
+	}
+}
+
+// next returns the queues in the order they should be
+// requested.
+func (s *scheduler) next() []*Queue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	first, total := -1, 0
+	for i, queue := range s.queues {
+		if queue.Weight <= 0 {
+			continue
+		}
+		total += queue.Weight
+		s.current[i] += queue.Weight
+		if first == -1 || s.current[i] > s.current[first] {
+			first = i
+		}
+	}
+	if first == -1 {
+		return s.queues
+	}
+	s.current[first] -= total
+
+	out := make([]*Queue, 0, len(s.queues))
+	out = append(out, s.queues[first])
+	for i, queue := range s.queues {
+		if i != first {
+			out = append(out, queue)
+		}
+	}
+	return out
+}
+
+// request requests the next stage from the queues. If
+// multiple queues are configured, each queue is requested
+// in turn until a stage is returned or the queue timeout
+// expires.
+func (p *Poller) request(ctx context.Context) (*drone.Stage, error) {
+	sched := p.scheduler()
+	if sched == nil {
+		return p.Client.Request(ctx, p.Filter)
+	}
+	queues := sched.next()
+	if len(queues) == 1 {
+		return p.Client.Request(ctx, queues[0].Filter)
+	}
+
+	timeout := p.QueueTimeout
+	if timeout <= 0 {
+		timeout = defaultQueueTimeout
+	}
+	for _, queue := range queues {
+		reqctx, cancel := context.WithTimeout(ctx, timeout)
+		stage, err := p.Client.Request(reqctx, queue.Filter)
+		expired := reqctx.Err() != nil
+		cancel()
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if stage != nil && stage.ID != 0 {
+			return stage, nil
+		}
+		// if the queue timeout expired, we request the
+		// next queue.
+		if expired {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// scheduler returns the queue scheduler, or nil if no
+// queues are configured.
+func (p *Poller) scheduler() *scheduler {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sched == nil && len(p.Queues) != 0 {
+		p.sched = newScheduler(p.Queues)
+	}
+	return p.sched
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package poller
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+)
+
+func TestScheduler_Priority(t *testing.T) {
+	low := &Queue{Filter: &client.Filter{Type: "build"}}
+	high := &Queue{Filter: &client.Filter{Type: "deploy"}, Priority: 10}
+	s := newScheduler([]*Queue{low, high})
+	for i := 0; i < 3; i++ {
+		got := s.next()
+		if len(got) != 2 || got[0] != high || got[1] != low {
+			t.Errorf("Want queues requested in priority order")
+		}
+	}
+}
+
+func TestScheduler_Weighted(t *testing.T) {
+	low := &Queue{Filter: &client.Filter{Type: "build"}, Weight: 1}
+	high := &Queue{Filter: &client.Filter{Type: "deploy"}, Priority: 10, Weight: 3}
+	s := newScheduler([]*Queue{low, high})
+
+	counts := map[*Queue]int{}
+	for i := 0; i < 8; i++ {
+		got := s.next()
+		if len(got) != 2 || got[0] == got[1] {
+			t.Errorf("Want each queue requested once per cycle")
+			return
+		}
+		counts[got[0]]++
+	}
+	if got, want := counts[high], 6; got != want {
+		t.Errorf("Want high priority queue requested first %d times, got %d", want, got)
+	}
+	if got, want := counts[low], 2; got != want {
+		t.Errorf("Want low priority queue requested first %d times, got %d", want, got)
+	}
+}
+
+func TestPoll_Queues(t *testing.T) {
+	mock := &mockFilterClient{
+		stages: map[string]*drone.Stage{"build": {ID: 1}},
+	}
+	p := &Poller{
+		Client:       mock,
+		QueueTimeout: 10 * time.Millisecond,
+		Queues: []*Queue{
+			{Filter: &client.Filter{Type: "build"}},
+			{Filter: &client.Filter{Type: "deploy"}, Priority: 10},
+		},
+	}
+	stage, err := p.request(noContext)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if stage == nil || stage.ID != 1 {
+		t.Errorf("Want stage from the low priority queue, got %+v", stage)
+	}
+	if got, want := mock.requested, []string{"deploy", "build"}; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Want queues requested %v, got %v", want, got)
+	}
+}
+
+// mock client that returns the stage for the filter type,
+// or blocks until the context is canceled.
+type mockFilterClient struct {
+	client.Client
+
+	sync.Mutex
+	stages    map[string]*drone.Stage
+	requested []string
+}
+
+func (m *mockFilterClient) Request(ctx context.Context, args *client.Filter) (*drone.Stage, error) {
+	m.Lock()
+	m.requested = append(m.requested, args.Type)
+	stage, ok := m.stages[args.Type]
+	m.Unlock()
+	if ok {
+		return stage, nil
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
@@ -0,0 +1,165 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package poller
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// samplingSupported is true because host resource sampling
+// is supported on this platform.
+const samplingSupported = true
+
+// sampler samples the host resource utilization from the
+// proc filesystem and the filesystem statistics.
+type sampler struct {
+	path string
+
+	mu   sync.Mutex
+	prev *cpuTimes
+}
+
+func newSampler(path string) *sampler {
+	if path == "" {
+		path = "/"
+	}
+	return &sampler{path: path}
+}
+
+// Sample returns the host resource utilization. The cpu
+// utilization is measured since the previous sample, or
+// since boot for the first sample.
+func (s *sampler) Sample() (*Resources, error) {
+	out := new(Resources)
+
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return nil, err
+	}
+	curr, err := parseStat(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	out.CPU = curr.usage(s.prev)
+	s.prev = curr
+	s.mu.Unlock()
+
+	f, err = os.Open("/proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	out.Memory, err = parseMeminfo(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(s.path, &stat); err != nil {
+		return nil, err
+	}
+	if stat.Blocks > 0 {
+		out.Disk = 1 - float64(stat.Bavail)/float64(stat.Blocks)
+	}
+	return out, nil
+}
+
+// cpuTimes provides the cumulative cpu times.
+type cpuTimes struct {
+	idle  uint64
+	total uint64
+}
+
+// usage returns the cpu utilization since the previous
+// cpu times.
+func (c *cpuTimes) usage(prev *cpuTimes) float64 {
+	idle, total := c.idle, c.total
+	if prev != nil && c.total > prev.total {
+		idle -= prev.idle
+		total -= prev.total
+	}
+	if total == 0 {
+		return 0
+	}
+	return 1 - float64(idle)/float64(total)
+}
+
+// helper function parses the aggregate cpu times from the
+// /proc/stat file.
+func parseStat(r io.Reader) (*cpuTimes, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+		out := new(cpuTimes)
+		for i, field := range fields[1:] {
+			v, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			// the idle and iowait times are the fourth
+			// and fifth values.
+			if i == 3 || i == 4 {
+				out.idle += v
+			}
+			// the guest times are included in the user
+			// times and are not counted twice.
+			if i < 8 {
+				out.total += v
+			}
+		}
+		return out, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("poller: cannot find cpu times")
+}
+
+// helper function parses the memory utilization from the
+// /proc/meminfo file.
+func parseMeminfo(r io.Reader) (float64, error) {
+	var total, available uint64
+	var hasAvailable bool
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = v
+		case "MemAvailable:":
+			available = v
+			hasAvailable = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if total == 0 || !hasAvailable {
+		return 0, errors.New("poller: cannot find memory usage")
+	}
+	return 1 - float64(available)/float64(total), nil
+}
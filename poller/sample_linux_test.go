@@ -0,0 +1,72 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package poller
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseStat(t *testing.T) {
+	prev, err := parseStat(strings.NewReader(
+		"cpu  100 0 100 700 100 0 0 0 0 0\ncpu0 100 0 100 700 100 0 0 0 0 0\n",
+	))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	curr, err := parseStat(strings.NewReader(
+		"cpu  400 0 200 800 200 0 0 0 0 0\n",
+	))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := prev.usage(nil), 0.2; !almostEqual(got, want) {
+		t.Errorf("Want cpu usage %v since boot, got %v", want, got)
+	}
+	if got, want := curr.usage(prev), 2.0/3; !almostEqual(got, want) {
+		t.Errorf("Want cpu usage %v since previous sample, got %v", want, got)
+	}
+	if _, err := parseStat(strings.NewReader("intr 1 2 3\n")); err == nil {
+		t.Errorf("Expect error when cpu times are missing")
+	}
+}
+
+func TestParseMeminfo(t *testing.T) {
+	got, err := parseMeminfo(strings.NewReader(
+		"MemTotal:       16000000 kB\nMemFree:         2000000 kB\nMemAvailable:    4000000 kB\n",
+	))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if want := 0.75; !almostEqual(got, want) {
+		t.Errorf("Want memory usage %v, got %v", want, got)
+	}
+	if _, err := parseMeminfo(strings.NewReader("MemTotal: 1 kB\n")); err == nil {
+		t.Errorf("Expect error when available memory is missing")
+	}
+}
+
+func TestSampler(t *testing.T) {
+	r, err := newSampler("").Sample()
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, v := range []float64{r.CPU, r.Memory, r.Disk} {
+		if v < 0 || v > 1 {
+			t.Errorf("Want utilization between 0 and 1, got %+v", r)
+		}
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
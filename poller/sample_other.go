@@ -0,0 +1,28 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package poller
+
+import "errors"
+
+// samplingSupported is false because host resource
+// sampling is not supported on this platform.
+const samplingSupported = false
+
+// sampler is a no-op sampler for platforms where host
+// resource sampling is not supported.
+type sampler struct{}
+
+func newSampler(string) *sampler {
+	return new(sampler)
+}
+
+// Sample returns an error because sampling is not
+// supported on this platform.
+func (s *sampler) Sample() (*Resources, error) {
+	return nil, errors.New("poller: resource sampling not supported")
+}
@@ -0,0 +1,29 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package testreport
+
+import (
+	"encoding/json"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/pipeline"
+)
+
+// Card returns the json-encoded test summary card with the
+// schema url. There is no default schema, and the caller
+// provides the url of a schema the server can render.
+func Card(schema string, report *pipeline.TestReport) ([]byte, error) {
+	data, err := json.Marshal(struct {
+		Total int `json:"total"`
+		*pipeline.TestReport
+	}{report.Total(), report})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&drone.CardInput{
+		Schema: schema,
+		Data:   data,
+	})
+}
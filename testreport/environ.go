@@ -0,0 +1,22 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package testreport
+
+import (
+	"fmt"
+
+	"github.com/drone/runner-go/pipeline"
+)
+
+// Environ returns a set of environment variables containing
+// the aggregated test results.
+func Environ(report pipeline.TestReport) map[string]string {
+	return map[string]string{
+		"DRONE_TESTS_TOTAL":   fmt.Sprint(report.Total()),
+		"DRONE_TESTS_PASSED":  fmt.Sprint(report.Passed),
+		"DRONE_TESTS_FAILED":  fmt.Sprint(report.Failed),
+		"DRONE_TESTS_SKIPPED": fmt.Sprint(report.Skipped),
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package testreport
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/drone/runner-go/pipeline"
+)
+
+// junitSuite represents a junit testsuites or testsuite
+// element. Test suites may be nested.
+type junitSuite struct {
+	Suites []*junitSuite `xml:"testsuite"`
+	Cases  []*junitCase  `xml:"testcase"`
+}
+
+// junitCase represents a junit testcase element.
+type junitCase struct {
+	Name      string    `xml:"name,attr"`
+	Classname string    `xml:"classname,attr"`
+	Failure   *struct{} `xml:"failure"`
+	Error     *struct{} `xml:"error"`
+	Skipped   *struct{} `xml:"skipped"`
+}
+
+// ParseJUnit parses a JUnit xml test report. The root
+// element may be a testsuites or testsuite element.
+func ParseJUnit(r io.Reader) (*pipeline.TestReport, error) {
+	suite := new(junitSuite)
+	if err := xml.NewDecoder(r).Decode(suite); err != nil {
+		return nil, fmt.Errorf("testreport: invalid junit report: %s", err)
+	}
+	report := new(pipeline.TestReport)
+	walkJUnit(report, suite)
+	return report, nil
+}
+
+func walkJUnit(report *pipeline.TestReport, suite *junitSuite) {
+	for _, c := range suite.Cases {
+		switch {
+		case c.Failure != nil, c.Error != nil:
+			report.Failed++
+			addFailure(report, c.name())
+		case c.Skipped != nil:
+			report.Skipped++
+		default:
+			report.Passed++
+		}
+	}
+	for _, s := range suite.Suites {
+		walkJUnit(report, s)
+	}
+}
+
+// name returns the qualified test name.
+func (c *junitCase) name() string {
+	if c.Classname == "" {
+		return c.Name
+	}
+	return c.Classname + "." + c.Name
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package testreport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/drone/runner-go/pipeline"
+)
+
+var (
+	// regular expression matches a tap test line, for
+	// example, `not ok 2 - description # SKIP reason`.
+	tapTest = regexp.MustCompile(`^(not ok|ok)\b\s*(\d+)?\s*(?:-\s*)?([^#]*)(?:#\s*(\w+))?`)
+
+	// regular expression matches a tap plan, for example,
+	// `1..4`.
+	tapPlan = regexp.MustCompile(`^1\.\.(\d+)`)
+)
+
+// ParseTAP parses a TAP test report. Subtests are ignored,
+// and tests that are planned but not reported are counted
+// as failed.
+func ParseTAP(r io.Reader) (*pipeline.TestReport, error) {
+	report := new(pipeline.TestReport)
+	planned := -1
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "Bail out!"):
+			report.Failed++
+			addFailure(report, strings.TrimSpace(line))
+		case tapPlan.MatchString(line):
+			planned, _ = strconv.Atoi(tapPlan.FindStringSubmatch(line)[1])
+		case tapTest.MatchString(line):
+			match := tapTest.FindStringSubmatch(line)
+			directive := strings.ToUpper(match[4])
+			name := strings.TrimSpace(match[3])
+			if name == "" {
+				name = "test " + match[2]
+			}
+			switch {
+			case directive == "SKIP", directive == "TODO":
+				report.Skipped++
+			case match[1] == "ok":
+				report.Passed++
+			default:
+				report.Failed++
+				addFailure(report, name)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("testreport: invalid tap report: %s", err)
+	}
+	if planned == -1 && report.Total() == 0 {
+		return nil, fmt.Errorf("testreport: invalid tap report: no tests found")
+	}
+	if missing := planned - report.Total(); planned != -1 && missing > 0 {
+		report.Failed += missing
+		addFailure(report, fmt.Sprintf("%d planned tests not run", missing))
+	}
+	return report, nil
+}
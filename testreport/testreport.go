@@ -0,0 +1,73 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package testreport provides utilities for parsing test
+// reports and summarizing the test results of a pipeline
+// step.
+//
+// The test summary card has no default schema. Runners opt
+// in to uploading the card by setting the schema url with
+// runtime.Execer.SetTestCardSchema.
+package testreport
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/drone/runner-go/pipeline"
+)
+
+// Test report formats.
+const (
+	JUnit = "junit"
+	TAP   = "tap"
+)
+
+// MaxFailures is the maximum number of failed test names
+// stored in a test report.
+const MaxFailures = 100
+
+// Parse parses the test report in the named format. If the
+// format is empty, the format is detected from the report.
+func Parse(format string, data []byte) (*pipeline.TestReport, error) {
+	if format == "" {
+		format = Detect(data)
+	}
+	switch format {
+	case JUnit:
+		return ParseJUnit(bytes.NewReader(data))
+	case TAP:
+		return ParseTAP(bytes.NewReader(data))
+	default:
+		return nil, fmt.Errorf("testreport: unsupported format %q", format)
+	}
+}
+
+// Detect returns the format of the test report. A report
+// that starts with an xml element is detected as a JUnit
+// report, otherwise the report is detected as a TAP report.
+func Detect(data []byte) string {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+		return JUnit
+	}
+	return TAP
+}
+
+// Merge merges the test results of src into dst.
+func Merge(dst, src *pipeline.TestReport) {
+	dst.Passed += src.Passed
+	dst.Failed += src.Failed
+	dst.Skipped += src.Skipped
+	for _, name := range src.Failures {
+		addFailure(dst, name)
+	}
+}
+
+// helper function adds the named test failure to the
+// report, up to the maximum number of failures.
+func addFailure(r *pipeline.TestReport, name string) {
+	if len(r.Failures) < MaxFailures {
+		r.Failures = append(r.Failures, name)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package testreport
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/pipeline"
+)
+
+const testJUnit = `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="math">
+    <testcase classname="math" name="TestAdd"/>
+    <testcase classname="math" name="TestSub">
+      <failure message="expected 1, got 2"/>
+    </testcase>
+    <testsuite name="nested">
+      <testcase classname="math.nested" name="TestMul">
+        <skipped/>
+      </testcase>
+      <testcase classname="math.nested" name="TestDiv">
+        <error message="panic"/>
+      </testcase>
+    </testsuite>
+  </testsuite>
+</testsuites>`
+
+const testTAP = `TAP version 13
+1..6
+ok 1 - add
+not ok 2 - subtract
+  ---
+  message: expected 1, got 2
+  ...
+ok 3 - multiply # SKIP not implemented
+not ok 4 - divide # TODO
+    not ok 1 - ignored subtest
+ok 5
+`
+
+func TestParseJUnit(t *testing.T) {
+	got, err := Parse("", []byte(testJUnit))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := &pipeline.TestReport{
+		Passed:   1,
+		Failed:   2,
+		Skipped:  1,
+		Failures: []string{"math.TestSub", "math.nested.TestDiv"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Want report %+v, got %+v", want, got)
+	}
+}
+
+func TestParseJUnit_Suite(t *testing.T) {
+	got, err := Parse(JUnit, []byte(`<testsuite><testcase name="TestAdd"/></testsuite>`))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got.Passed != 1 || got.Total() != 1 {
+		t.Errorf("Want testsuite root element parsed, got %+v", got)
+	}
+}
+
+func TestParseJUnit_Invalid(t *testing.T) {
+	if _, err := Parse(JUnit, []byte("<testsuite>")); err == nil {
+		t.Errorf("Expect error parsing invalid junit report")
+	}
+}
+
+func TestParseTAP(t *testing.T) {
+	got, err := Parse("", []byte(testTAP))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := &pipeline.TestReport{
+		Passed:   2,
+		Failed:   2,
+		Skipped:  2,
+		Failures: []string{"subtract", "1 planned tests not run"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Want report %+v, got %+v", want, got)
+	}
+}
+
+func TestParseTAP_Invalid(t *testing.T) {
+	if _, err := Parse(TAP, []byte("hello world")); err == nil {
+		t.Errorf("Expect error parsing report without tests")
+	}
+	if _, err := Parse("xunit", []byte("hello world")); err == nil {
+		t.Errorf("Expect error parsing unsupported format")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	dst := &pipeline.TestReport{Passed: 1}
+	src := &pipeline.TestReport{Passed: 2, Failed: 1, Failures: []string{"TestSub"}}
+	for i := 0; i < MaxFailures+1; i++ {
+		Merge(dst, src)
+	}
+	if got, want := dst.Passed, 2*(MaxFailures+1)+1; got != want {
+		t.Errorf("Want %d passed tests, got %d", want, got)
+	}
+	if got, want := len(dst.Failures), MaxFailures; got != want {
+		t.Errorf("Want %d failures, got %d", want, got)
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	got := Environ(pipeline.TestReport{Passed: 3, Failed: 1, Skipped: 2})
+	want := map[string]string{
+		"DRONE_TESTS_TOTAL":   "6",
+		"DRONE_TESTS_PASSED":  "3",
+		"DRONE_TESTS_FAILED":  "1",
+		"DRONE_TESTS_SKIPPED": "2",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Want environment %v, got %v", want, got)
+	}
+}
+
+func TestCard(t *testing.T) {
+	schema := "https://example.com/tests.json"
+	out, err := Card(schema, &pipeline.TestReport{Passed: 3, Failed: 1, Failures: []string{"TestSub"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	card := new(drone.CardInput)
+	if err := json.Unmarshal(out, card); err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := card.Schema, schema; got != want {
+		t.Errorf("Want schema %q, got %q", want, got)
+	}
+	data := map[string]interface{}{}
+	json.Unmarshal(card.Data, &data)
+	if got, want := data["total"], float64(4); got != want {
+		t.Errorf("Want total %v, got %v", want, got)
+	}
+	if got, want := data["failed"], float64(1); got != want {
+		t.Errorf("Want failed %v, got %v", want, got)
+	}
+}